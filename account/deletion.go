@@ -0,0 +1,175 @@
+// Package account handles the lifecycle of a user's personal data: exporting
+// it, scheduling the account for deletion and purging it once the grace
+// period is over.
+package account
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/lockout"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/search"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GracePeriod is how long a deleted account can still be restored by logging
+// in, from ACCOUNT_DELETION_GRACE (default 30 days)
+func GracePeriod() time.Duration {
+	return durationFromEnv("ACCOUNT_DELETION_GRACE", 30*24*time.Hour)
+}
+
+// ScheduleDeletion marks the account for deletion after the grace period and
+// logs it out everywhere: sessions and API keys are revoked. It returns when
+// the account will be purged. The caller runs it in a transaction.
+func ScheduleDeletion(tx *gorm.DB, userID int) (time.Time, error) {
+	now := time.Now()
+	deleteAt := now.Add(GracePeriod())
+
+	err := tx.Model(&models.User{}).Where("id = ?", userID).Update("deletion_scheduled_at", deleteAt).Error
+	if err != nil {
+		return deleteAt, err
+	}
+
+	if _, err := auth.RevokeUserSessions(tx, userID, ""); err != nil {
+		return deleteAt, err
+	}
+
+	err = tx.Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error
+	return deleteAt, err
+}
+
+// CancelDeletion keeps an account that was scheduled for deletion
+func CancelDeletion(userID int) error {
+	return db.DB.Model(&models.User{}).
+		Where("id = ? AND deletion_scheduled_at IS NOT NULL", userID).
+		Update("deletion_scheduled_at", nil).Error
+}
+
+// Purge permanently deletes the user and everything that belongs to them.
+// Rows that reference the user through a foreign key are removed by their
+// ON DELETE CASCADE constraints; the rest is deleted here. It returns the
+// products taken out of the catalogue, which the caller removes from the
+// search index once the transaction has committed.
+func Purge(tx *gorm.DB, user models.User) ([]int, error) {
+	if err := tx.Model(&user).Association("Roles").Clear(); err != nil {
+		return nil, err
+	}
+
+	// Products only keep the owner's ID as a string, without a foreign key.
+	// They are soft-deleted and lose the owner's ID instead of being removed,
+	// so other customers' carts flag them as unavailable rather than losing
+	// the line through the cart's ON DELETE CASCADE.
+	var productIDs []int
+	products := tx.Unscoped().Model(&models.Product{}).Where("user_id = ?", strconv.Itoa(user.ID))
+	if err := products.Pluck("id", &productIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(productIDs) > 0 {
+		err := tx.Unscoped().Model(&models.Product{}).Where("id IN ?", productIDs).Updates(map[string]interface{}{
+			"deleted_at": gorm.Expr("COALESCE(deleted_at, ?)", time.Now()),
+			"user_id":    "",
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Delete(&user).Error; err != nil {
+		return nil, err
+	}
+
+	// Audit events keep the user ID but lose the personal data in them
+	if err := audit.Anonymize(tx, user.ID, user.Email); err != nil {
+		return nil, err
+	}
+
+	// The purge is done by the server itself
+	err := audit.Record(tx, audit.Actor{}, audit.Event{
+		Action:  "user.purge",
+		Target:  audit.Target{Type: "user", ID: strconv.Itoa(user.ID)},
+		Details: map[string]interface{}{"products": len(productIDs)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Failed login counters are keyed by email, not by user ID
+	return productIDs, lockout.Accounts.Reset(user.Email)
+}
+
+// PurgeDue purges every account whose grace period ended before now and
+// returns how many were purged
+func PurgeDue(now time.Time) (int, error) {
+	var users []models.User
+	err := db.DB.Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", now).Find(&users).Error
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		restored := false
+		var productIDs []int
+		err := db.DB.Transaction(func(tx *gorm.DB) (err error) {
+			// Skip accounts that were restored since they were listed
+			var due models.User
+			err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", user.ID, now).
+				First(&due).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				restored = true
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			productIDs, err = Purge(tx, due)
+			return err
+		})
+		if err != nil {
+			return purged, err
+		}
+		for _, id := range productIDs {
+			search.RemoveProduct(id)
+		}
+		if !restored {
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// StartPurger purges due accounts now and then every ACCOUNT_PURGE_INTERVAL
+// (default 1h) in the background
+func StartPurger() {
+	interval := durationFromEnv("ACCOUNT_PURGE_INTERVAL", time.Hour)
+
+	go func() {
+		for {
+			if n, err := PurgeDue(time.Now()); err != nil {
+				log.Printf("account purge failed: %v", err)
+			} else if n > 0 {
+				log.Printf("purged %d deleted accounts", n)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
@@ -0,0 +1,99 @@
+package account
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/dto"
+	"github.com/raihan1405/go-restapi/models"
+	"gorm.io/gorm"
+)
+
+// APIKey is an API key in an export, with its scopes but without its hash
+type APIKey struct {
+	models.APIKey
+	Scopes []string `json:"scopes"`
+}
+
+// Export is everything stored about a user. Secrets such as password hashes,
+// token hashes and TOTP secrets are left out.
+type Export struct {
+	ExportedAt time.Time             `json:"exportedAt"`
+	Profile    dto.User              `json:"profile"`
+	Identities []models.UserIdentity `json:"identities"`
+	Sessions   []models.Session      `json:"sessions"`
+	APIKeys    []APIKey              `json:"apiKeys"`
+	Cart       []models.CartItem     `json:"cart"`
+	Products   []models.Product      `json:"products"`
+}
+
+// BuildExport collects the data of the user
+func BuildExport(userID int) (*Export, error) {
+	var user models.User
+	if err := db.DB.Preload("Roles").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	export := &Export{ExportedAt: time.Now(), Profile: dto.NewUser(user)}
+
+	if err := db.DB.Where("user_id = ?", userID).Order("id").Find(&export.Identities).Error; err != nil {
+		return nil, err
+	}
+	if err := db.DB.Where("user_id = ?", userID).Order("created_at").Find(&export.Sessions).Error; err != nil {
+		return nil, err
+	}
+	// Deleted products are still part of the user's data
+	withDeleted := func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }
+	if err := db.DB.Preload("Product", withDeleted).Where("user_id = ?", userID).Order("id").Find(&export.Cart).Error; err != nil {
+		return nil, err
+	}
+	if err := db.DB.Unscoped().Where("user_id = ?", strconv.Itoa(userID)).Order("id").Find(&export.Products).Error; err != nil {
+		return nil, err
+	}
+
+	var keys []models.APIKey
+	if err := db.DB.Where("user_id = ?", userID).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	export.APIKeys = make([]APIKey, 0, len(keys))
+	for _, key := range keys {
+		export.APIKeys = append(export.APIKeys, APIKey{APIKey: key, Scopes: key.ScopeList()})
+	}
+
+	return export, nil
+}
+
+// WriteZip writes the export as a ZIP archive with one JSON file per section
+func (e *Export) WriteZip(w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", e.Profile},
+		{"identities.json", e.Identities},
+		{"sessions.json", e.Sessions},
+		{"api_keys.json", e.APIKeys},
+		{"cart.json", e.Cart},
+		{"products.json", e.Products},
+	}
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: e.ExportedAt})
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
@@ -0,0 +1,163 @@
+// Package audit writes the audit log. Events are recorded with the
+// transaction of the change they describe, so they are only stored if the
+// change is.
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+
+	"github.com/raihan1405/go-restapi/models"
+	"gorm.io/gorm"
+)
+
+// removed replaces personal data in the events of purged users
+const removed = "[removed]"
+
+// Actor is who performs an action and from where. UserID is nil for
+// anonymous requests. ImpersonatorID is set when an admin acts as UserID.
+type Actor struct {
+	UserID         *int
+	ImpersonatorID *int
+	IPAddress      string
+	UserAgent      string
+	RequestID      string
+}
+
+// Target is the object an action applies to
+type Target struct {
+	Type string
+	ID   string
+}
+
+// Event describes one action. Before and After are the state of the target
+// around the change, as anything that encodes to a JSON object; only the
+// fields that differ are stored. Before is nil for creations and After is
+// nil for deletions. Details holds anything else worth keeping.
+type Event struct {
+	Action  string
+	Target  Target
+	Before  interface{}
+	After   interface{}
+	Details interface{}
+}
+
+// Record stores an event
+func Record(tx *gorm.DB, actor Actor, event Event) error {
+	row := models.AuditEvent{
+		ActorID:        actor.UserID,
+		ImpersonatorID: actor.ImpersonatorID,
+		Action:         event.Action,
+		TargetType:     event.Target.Type,
+		TargetID:       event.Target.ID,
+		IPAddress:      actor.IPAddress,
+		UserAgent:      truncate(actor.UserAgent, 255),
+		RequestID:      truncate(actor.RequestID, 64),
+	}
+
+	var err error
+	if row.Before, row.After, err = diff(event.Before, event.After); err != nil {
+		return err
+	}
+	if row.Details, err = encode(event.Details); err != nil {
+		return err
+	}
+
+	return tx.Create(&row).Error
+}
+
+// Anonymize removes the personal data of a purged user from the audit log,
+// the only change ever made to recorded events. The events themselves and
+// the user ID in them are kept:
+//   - the email, phone number and username in the before and after state of
+//     the user are replaced
+//   - the IP address and user agent are cleared from the user's own actions,
+//     but not from what an admin did while impersonating them
+//   - failed logins for the email before the account existed lose the email
+//
+// It bypasses the append-only hooks of models.AuditEvent on purpose.
+func Anonymize(tx *gorm.DB, userID int, email string) error {
+	events := func() *gorm.DB { return tx.Table("audit_events") }
+
+	redact := func(column string) interface{} {
+		return gorm.Expr("JSON_REPLACE(`"+column+"`, '$.email', ?, '$.phoneNumber', ?, '$.username', ?)", removed, removed, removed)
+	}
+	err := events().
+		Where("target_type = ? AND target_id = ?", "user", strconv.Itoa(userID)).
+		Updates(map[string]interface{}{"before": redact("before"), "after": redact("after")}).Error
+	if err != nil {
+		return err
+	}
+
+	err = events().
+		Where("(actor_id = ? AND impersonator_id IS NULL) OR impersonator_id = ?", userID, userID).
+		Updates(map[string]interface{}{"ip_address": "", "user_agent": ""}).Error
+	if err != nil {
+		return err
+	}
+
+	return events().
+		Where("target_type = ? AND target_id = '' AND JSON_UNQUOTE(JSON_EXTRACT(details, '$.email')) = ?", "user", email).
+		Update("details", gorm.Expr("JSON_REPLACE(details, '$.email', ?)", removed)).Error
+}
+
+// diff encodes before and after, keeping only the fields that changed
+func diff(before, after interface{}) (json.RawMessage, json.RawMessage, error) {
+	old, err := fields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	next, err := fields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if old != nil && next != nil {
+		for key, value := range old {
+			if other, ok := next[key]; ok && reflect.DeepEqual(value, other) {
+				delete(old, key)
+				delete(next, key)
+			}
+		}
+	}
+
+	oldJSON, err := encode(old)
+	if err != nil {
+		return nil, nil, err
+	}
+	newJSON, err := encode(next)
+	return oldJSON, newJSON, err
+}
+
+// fields decodes the JSON form of v into a map
+func fields(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(encoded, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func encode(v interface{}) (json.RawMessage, error) {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Map && reflect.ValueOf(v).IsNil() {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,135 @@
+package audit
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/db/dbtest"
+)
+
+type product struct {
+	Name     string   `json:"name"`
+	Price    int      `json:"price"`
+	Tags     []string `json:"tags"`
+	Internal string   `json:"-"`
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after interface{}
+		wantBefore    string
+		wantAfter     string
+	}{
+		{
+			name:       "changed field",
+			before:     product{Name: "Shoe", Price: 10},
+			after:      product{Name: "Shoe", Price: 12},
+			wantBefore: `{"price":10}`,
+			wantAfter:  `{"price":12}`,
+		},
+		{
+			name:       "changed slice",
+			before:     product{Name: "Shoe", Tags: []string{"a"}},
+			after:      product{Name: "Shoe", Tags: []string{"a", "b"}},
+			wantBefore: `{"tags":["a"]}`,
+			wantAfter:  `{"tags":["a","b"]}`,
+		},
+		{
+			name:       "unchanged",
+			before:     product{Name: "Shoe", Price: 10},
+			after:      product{Name: "Shoe", Price: 10},
+			wantBefore: `{}`,
+			wantAfter:  `{}`,
+		},
+		{
+			name:       "fields hidden from JSON are not stored",
+			before:     product{Name: "Shoe", Internal: "a"},
+			after:      product{Name: "Shoe", Internal: "b"},
+			wantBefore: `{}`,
+			wantAfter:  `{}`,
+		},
+		{
+			name:      "creation has no before",
+			after:     product{Name: "Shoe", Price: 10},
+			wantAfter: `{"name":"Shoe","price":10,"tags":null}`,
+		},
+		{
+			name:       "deletion has no after",
+			before:     product{Name: "Shoe", Price: 10},
+			wantBefore: `{"name":"Shoe","price":10,"tags":null}`,
+		},
+		{
+			name: "neither",
+		},
+		{
+			name:       "field only on one side",
+			before:     map[string]interface{}{"name": "Shoe"},
+			after:      map[string]interface{}{"name": "Shoe", "price": 10},
+			wantBefore: `{}`,
+			wantAfter:  `{"price":10}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before, after, err := diff(test.before, test.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(before) != test.wantBefore {
+				t.Errorf("before = %s, want %s", before, test.wantBefore)
+			}
+			if string(after) != test.wantAfter {
+				t.Errorf("after = %s, want %s", after, test.wantAfter)
+			}
+		})
+	}
+}
+
+func TestDiffRejectsNonObjects(t *testing.T) {
+	if _, _, err := diff("not an object", nil); err == nil {
+		t.Error("diff of a string should fail, events describe objects")
+	}
+}
+
+func TestRecord(t *testing.T) {
+	fake := dbtest.Use(t, func(string) ([]string, [][]driver.Value) { return nil, nil })
+
+	userID := 7
+	actor := Actor{UserID: &userID, IPAddress: "192.0.2.1", UserAgent: strings.Repeat("x", 300), RequestID: "req-1"}
+	event := Event{
+		Action:  "product.update",
+		Target:  Target{Type: "product", ID: "3"},
+		Before:  product{Name: "Shoe", Price: 10},
+		After:   product{Name: "Shoe", Price: 12},
+		Details: map[string]interface{}{"reason": "sale"},
+	}
+	if err := Record(db.DB, actor, event); err != nil {
+		t.Fatal(err)
+	}
+
+	args, ok := fake.Executed("INSERT INTO `audit_events`")
+	if !ok {
+		t.Fatal("no audit event was inserted")
+	}
+
+	// Columns in the order of models.AuditEvent, without the ID
+	want := []interface{}{int64(7), nil, "product.update", "product", "3",
+		`{"price":10}`, `{"price":12}`, `{"reason":"sale"}`, "192.0.2.1", strings.Repeat("x", 255), "req-1"}
+	for i, value := range want {
+		got := args[i]
+		if raw, ok := got.([]byte); ok {
+			got = string(raw)
+		}
+		if raw, ok := got.(json.RawMessage); ok {
+			got = string(raw)
+		}
+		if got != value {
+			t.Errorf("column %d = %#v, want %#v", i, got, value)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+)
+
+// APIKeyPrefix starts every API key so it can be told apart from a JWT
+const APIKeyPrefix = "sk_"
+
+// apiKeyIDLength is the number of hex digits of the key ID in the prefix. It
+// fills the 16 characters of the prefix column. Keys made before it was
+// raised have legacyAPIKeyIDLength digits and keep working.
+const (
+	apiKeyIDLength       = 13
+	legacyAPIKeyIDLength = 8
+)
+
+// ErrInvalidAPIKey is returned for unknown, expired or revoked API keys
+var ErrInvalidAPIKey = errors.New("invalid, expired or revoked API key")
+
+// NewAPIKey generates a key of the form sk_<id>_<secret>. The returned prefix
+// (sk_<id>) is stored in clear to look the key up and show it in listings.
+func NewAPIKey() (key, prefix string, err error) {
+	id, err := NewID()
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, err := NewOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	prefix = APIKeyPrefix + id[:apiKeyIDLength]
+	return prefix + "_" + secret, prefix, nil
+}
+
+// IsAPIKey reports whether a bearer credential looks like an API key
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// apiKeyPrefix cuts the prefix off a key. The secret may itself contain "_",
+// so the prefix is cut at its fixed length rather than at an underscore.
+func apiKeyPrefix(key string) (string, bool) {
+	if !IsAPIKey(key) {
+		return "", false
+	}
+
+	for _, n := range []int{apiKeyIDLength, legacyAPIKeyIDLength} {
+		end := len(APIKeyPrefix) + n
+		if len(key) > end+1 && key[end] == '_' && isHex(key[len(APIKeyPrefix):end]) {
+			return key[:end], true
+		}
+	}
+	return "", false
+}
+
+// isHex reports whether s only consists of lowercase hex digits
+func isHex(s string) bool {
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyAPIKey looks the key up by its prefix and checks the hash of the
+// whole key. The key's last-used timestamp is updated at most once a minute.
+func VerifyAPIKey(key string) (*models.APIKey, error) {
+	prefix, ok := apiKeyPrefix(key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var apiKey models.APIKey
+	if err := db.DB.Where("prefix = ?", prefix).First(&apiKey).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(HashToken(key))) != 1 || !apiKey.Active() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > time.Minute {
+		db.DB.Model(&apiKey).Update("last_used_at", now)
+		apiKey.LastUsedAt = &now
+	}
+
+	return &apiKey, nil
+}
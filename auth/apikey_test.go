@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/raihan1405/go-restapi/db/dbtest"
+)
+
+// keyWithUnderscore issues API keys until one has "_" in its secret
+func keyWithUnderscore(t *testing.T) (key, prefix string) {
+	t.Helper()
+
+	for {
+		key, prefix, err := NewAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(key[len(prefix)+1:], "_") {
+			return key, prefix
+		}
+	}
+}
+
+// verifyWithStoredKey verifies key against a database holding a key with
+// the given prefix and hash, and returns the prefix it was looked up by
+func verifyWithStoredKey(t *testing.T, key, prefix string) (string, error) {
+	t.Helper()
+
+	fake := dbtest.Use(t, func(query string) ([]string, [][]driver.Value) {
+		return []string{"id", "user_id", "prefix", "key_hash"},
+			[][]driver.Value{{int64(1), int64(7), prefix, HashToken(key)}}
+	})
+
+	_, err := VerifyAPIKey(key)
+	args, ok := fake.Executed("SELECT * FROM `api_keys`")
+	if !ok {
+		return "", err
+	}
+	return args[0].(string), err
+}
+
+func TestVerifyAPIKeyWithUnderscoreInSecret(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		key, prefix := keyWithUnderscore(t)
+
+		looked, err := verifyWithStoredKey(t, key, prefix)
+		if err != nil {
+			t.Fatalf("VerifyAPIKey(%q) = %v", key, err)
+		}
+		if looked != prefix {
+			t.Fatalf("key %q looked up by prefix %q, want %q", key, looked, prefix)
+		}
+	}
+}
+
+func TestVerifyLegacyAPIKey(t *testing.T) {
+	// Keys made before the prefix was lengthened have 8 hex digits, and the
+	// secret may have "_" where a current prefix would end
+	key := "sk_0123abcd_abcd_fghijklmnopqrstuvwxyz0123456789ABCDEFG"
+
+	looked, err := verifyWithStoredKey(t, key, "sk_0123abcd")
+	if err != nil {
+		t.Fatalf("VerifyAPIKey(%q) = %v", key, err)
+	}
+	if looked != "sk_0123abcd" {
+		t.Fatalf("looked up by prefix %q, want sk_0123abcd", looked)
+	}
+}
+
+func TestAPIKeyPrefixRejectsMalformedKeys(t *testing.T) {
+	for _, key := range []string{
+		"",
+		"sk_",
+		"sk_0123456789abc",
+		"sk_0123456789abc_",
+		"sk_0123456789abc-secret",
+		"sk_0123456789ABC_secret",
+		"sk_0123_secret",
+		"pk_0123456789abc_secret",
+		"eyJhbGciOiJSUzI1NiJ9.e30.sig",
+	} {
+		if prefix, ok := apiKeyPrefix(key); ok {
+			t.Errorf("apiKeyPrefix(%q) = %q, want rejection", key, prefix)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/raihan1405/go-restapi/models"
+	"gorm.io/gorm"
+)
+
+// ImpersonationTTL is how long an impersonation session lasts, from
+// IMPERSONATION_TTL (default 30m). It cannot be extended by refreshing.
+func ImpersonationTTL() time.Duration {
+	return durationFromEnv("IMPERSONATION_TTL", 30*time.Minute)
+}
+
+// StartImpersonation opens a session in which the admin acts as the user.
+// Tokens of the session carry the admin in their act claim.
+func StartImpersonation(tx *gorm.DB, impersonatorID, userID int, userAgent, ip string) (*TokenPair, error) {
+	now := time.Now()
+	return startSession(tx, models.Session{
+		UserID:         userID,
+		ImpersonatorID: &impersonatorID,
+		UserAgent:      truncate(userAgent, 255),
+		IPAddress:      ip,
+		LastSeenAt:     now,
+		ExpiresAt:      now.Add(ImpersonationTTL()),
+	})
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+)
+
+// sealedKeyPrefix starts private keys that are stored encrypted. Keys stored
+// before encryption was introduced are plain PEM and are encrypted on start.
+const sealedKeyPrefix = "aes-gcm:"
+
+// ErrNoKeyEncryptionKey is returned when JWT_KEY_ENCRYPTION_KEY is not set
+var ErrNoKeyEncryptionKey = errors.New("JWT_KEY_ENCRYPTION_KEY is not set")
+
+// KeyEncryptionKeyFromEnv reads the key that encrypts the stored private
+// signing keys from JWT_KEY_ENCRYPTION_KEY: 32 random bytes, base64 encoded,
+// for example from "openssl rand -base64 32". It is kept out of the database
+// so that a database backup alone is not enough to sign tokens.
+func KeyEncryptionKeyFromEnv() (cipher.AEAD, error) {
+	encoded := os.Getenv("JWT_KEY_ENCRYPTION_KEY")
+	if encoded == "" {
+		return nil, ErrNoKeyEncryptionKey
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY must be 32 bytes, base64 encoded")
+	}
+	return newKeyCipher(key)
+}
+
+func newKeyCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealPrivateKey encrypts a PEM encoded private key. The kid is authenticated
+// along with it, so a sealed key cannot be moved to another row.
+func sealPrivateKey(aead cipher.AEAD, kid, privatePEM string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(privatePEM), []byte(kid))
+	return sealedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openPrivateKey decrypts a private key sealed by sealPrivateKey
+func openPrivateKey(aead cipher.AEAD, kid, stored string) (string, error) {
+	if !strings.HasPrefix(stored, sealedKeyPrefix) {
+		return "", errors.New("private key is not encrypted")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedKeyPrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("invalid encrypted private key")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	privatePEM, err := aead.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt private key, is JWT_KEY_ENCRYPTION_KEY the one it was encrypted with? %w", err)
+	}
+	return string(privatePEM), nil
+}
+
+// sealPlaintextKeys encrypts the private keys that are still stored as plain PEM
+func sealPlaintextKeys(aead cipher.AEAD) (int, error) {
+	var rows []models.SigningKey
+	if err := db.DB.Where("private_key NOT LIKE ?", sealedKeyPrefix+"%").Find(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	for _, row := range rows {
+		sealed, err := sealPrivateKey(aead, row.Kid, row.PrivateKey)
+		if err != nil {
+			return 0, err
+		}
+
+		// Another instance may have sealed the key meanwhile
+		err = db.DB.Model(&models.SigningKey{}).
+			Where("kid = ? AND private_key = ?", row.Kid, row.PrivateKey).
+			Update("private_key", sealed).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/db/dbtest"
+)
+
+func testKeyCipher(t *testing.T, fill byte) cipher.AEAD {
+	t.Helper()
+
+	aead, err := newKeyCipher(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aead
+}
+
+func TestSealPrivateKey(t *testing.T) {
+	aead := testKeyCipher(t, 1)
+	row, err := generateSigningKey(AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := sealPrivateKey(aead, row.Kid, row.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, sealedKeyPrefix) || strings.Contains(sealed, "PRIVATE KEY") {
+		t.Fatalf("sealed key %q is not encrypted", sealed)
+	}
+
+	opened, err := openPrivateKey(aead, row.Kid, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened != row.PrivateKey {
+		t.Error("the opened key differs from the sealed one")
+	}
+
+	if _, err := openPrivateKey(testKeyCipher(t, 2), row.Kid, sealed); err == nil {
+		t.Error("a key sealed with another encryption key should not open")
+	}
+	if _, err := openPrivateKey(aead, "other-kid", sealed); err == nil {
+		t.Error("a key sealed for another kid should not open")
+	}
+	if _, err := openPrivateKey(aead, row.Kid, row.PrivateKey); err == nil {
+		t.Error("a key stored in plain text should not be used")
+	}
+}
+
+func TestKeyEncryptionKeyFromEnv(t *testing.T) {
+	tests := map[string]bool{
+		"":                            false,
+		"not base64!":                 false,
+		"c2hvcnQ=":                    false,
+		strings.Repeat("A", 43) + "=": true,
+	}
+
+	for value, valid := range tests {
+		t.Setenv("JWT_KEY_ENCRYPTION_KEY", value)
+		if _, err := KeyEncryptionKeyFromEnv(); (err == nil) != valid {
+			t.Errorf("KeyEncryptionKeyFromEnv with %q = %v, want valid %v", value, err, valid)
+		}
+	}
+}
+
+func TestRotateStoresEncryptedKey(t *testing.T) {
+	fake := dbtest.Use(t, func(string) ([]string, [][]driver.Value) { return []string{"kid"}, nil })
+
+	keys := &KeyManager{aead: testKeyCipher(t, 1)}
+	row, err := keys.Rotate(audit.Actor{}, AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args, ok := fake.Executed("INSERT INTO `signing_keys`")
+	if !ok {
+		t.Fatal("no key was stored")
+	}
+	stored, _ := args[2].(string)
+	if !strings.HasPrefix(stored, sealedKeyPrefix) || stored != row.PrivateKey {
+		t.Fatalf("stored private key %q, want it encrypted", stored)
+	}
+	if _, err := openPrivateKey(keys.aead, row.Kid, stored); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&KeyManager{}).Rotate(audit.Actor{}, AlgEdDSA); err != ErrNoKeyEncryptionKey {
+		t.Errorf("Rotate without an encryption key = %v, want ErrNoKeyEncryptionKey", err)
+	}
+}
@@ -0,0 +1,370 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+	"gorm.io/gorm"
+)
+
+// Supported signing algorithms
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	// ErrUnknownKey is returned when a token names a key that does not exist or has expired
+	ErrUnknownKey = errors.New("unknown or expired signing key")
+	// ErrNoSigningKey is returned when no key is available to sign tokens
+	ErrNoSigningKey = errors.New("no active signing key")
+)
+
+// Keys is the application's key manager, loaded by InitKeys
+var Keys = &KeyManager{}
+
+// signingKey is a parsed models.SigningKey
+type signingKey struct {
+	kid       string
+	alg       string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	public    crypto.PublicKey
+	createdAt time.Time
+	retiredAt *time.Time
+	expiresAt *time.Time
+}
+
+func (k *signingKey) usable(now time.Time) bool {
+	return k.expiresAt == nil || now.Before(*k.expiresAt)
+}
+
+// KeyManager signs access tokens with the current key and verifies them with
+// any key that has not expired, selected by the kid header. Keys are stored in
+// the signing_keys table so that every instance uses the same set; their
+// private halves are encrypted with aead.
+type KeyManager struct {
+	aead     cipher.AEAD
+	mu       sync.RWMutex
+	keys     map[string]*signingKey
+	current  *signingKey
+	loadedAt time.Time
+}
+
+// InitKeys loads the signing keys, creates a first key with JWT_ALGORITHM
+// (RS256 by default, or EdDSA) if there is none, and reloads them every minute
+// to pick up rotations done by other instances. Private keys are encrypted
+// with JWT_KEY_ENCRYPTION_KEY, see KeyEncryptionKeyFromEnv.
+func InitKeys() {
+	aead, err := KeyEncryptionKeyFromEnv()
+	if err != nil {
+		log.Fatal("cannot load signing keys: ", err)
+	}
+	Keys.aead = aead
+
+	if n, err := sealPlaintextKeys(aead); err != nil {
+		log.Fatal("cannot encrypt stored signing keys: ", err)
+	} else if n > 0 {
+		log.Printf("encrypted %d signing keys stored in plain text", n)
+	}
+
+	if err := Keys.Load(); err != nil {
+		log.Fatal("cannot load signing keys: ", err)
+	}
+
+	if Keys.currentKey() == nil {
+		// The first key is created by the server itself, without an actor
+		if _, err := Keys.Rotate(audit.Actor{}, Keys.Algorithm()); err != nil {
+			log.Fatal("cannot create signing key: ", err)
+		}
+	}
+
+	go func() {
+		for range time.Tick(time.Minute) {
+			if err := Keys.Load(); err != nil {
+				log.Printf("cannot reload signing keys: %v", err)
+			}
+		}
+	}()
+}
+
+// KeyGracePeriod is how long a retired key keeps verifying tokens, from
+// JWT_KEY_GRACE. It defaults to twice the access token lifetime and is never
+// shorter than it.
+func KeyGracePeriod() time.Duration {
+	grace := durationFromEnv("JWT_KEY_GRACE", 2*AccessTokenTTL())
+	if grace < AccessTokenTTL() {
+		return AccessTokenTTL()
+	}
+	return grace
+}
+
+// Load replaces the cached keys with the non-expired keys from the database
+func (m *KeyManager) Load() error {
+	var rows []models.SigningKey
+	err := db.DB.Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at").
+		Find(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	if m.aead == nil {
+		return ErrNoKeyEncryptionKey
+	}
+
+	keys := make(map[string]*signingKey, len(rows))
+	var current *signingKey
+	for _, row := range rows {
+		privatePEM, err := openPrivateKey(m.aead, row.Kid, row.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", row.Kid, err)
+		}
+		row.PrivateKey = privatePEM
+
+		key, err := parseSigningKey(row)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", row.Kid, err)
+		}
+		keys[key.kid] = key
+		if key.retiredAt == nil {
+			current = key
+		}
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.current = current
+	m.loadedAt = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *KeyManager) currentKey() *signingKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.current
+}
+
+// Algorithm returns the algorithm of the current key, or JWT_ALGORITHM
+// (RS256 by default) when there is none
+func (m *KeyManager) Algorithm() string {
+	if key := m.currentKey(); key != nil {
+		return key.alg
+	}
+	if alg := os.Getenv("JWT_ALGORITHM"); alg != "" {
+		return alg
+	}
+	return AlgRS256
+}
+
+// Rotate creates a new key with the algorithm and makes it the signing key.
+// The previous keys are retired and keep verifying tokens for KeyGracePeriod.
+// The rotation is recorded in the audit log as done by the actor.
+func (m *KeyManager) Rotate(actor audit.Actor, alg string) (*models.SigningKey, error) {
+	if m.aead == nil {
+		return nil, ErrNoKeyEncryptionKey
+	}
+
+	row, err := generateSigningKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	if row.PrivateKey, err = sealPrivateKey(m.aead, row.Kid, row.PrivateKey); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expires := now.Add(KeyGracePeriod())
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		var retired []string
+		current := tx.Model(&models.SigningKey{}).Where("retired_at IS NULL")
+		if err := current.Pluck("kid", &retired).Error; err != nil {
+			return err
+		}
+
+		err := tx.Model(&models.SigningKey{}).
+			Where("kid IN ?", retired).
+			Updates(map[string]interface{}{"retired_at": now, "expires_at": expires}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(row).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, actor, audit.Event{
+			Action:  "key.rotate",
+			Target:  audit.Target{Type: "signing_key", ID: row.Kid},
+			After:   row,
+			Details: map[string]interface{}{"retired": retired},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return row, m.Load()
+}
+
+// Sign signs the claims with the current key and sets the kid header
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	key := m.currentKey()
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// Keyfunc returns the public key for a token's kid, checking that the token
+// uses the key's algorithm. It is meant for jwt.Parse and jwtware.Config.
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrUnknownKey
+	}
+
+	key := m.lookup(kid)
+	if key == nil {
+		// Another instance may have rotated; reload at most every ten seconds
+		m.mu.RLock()
+		stale := time.Since(m.loadedAt) > 10*time.Second
+		m.mu.RUnlock()
+		if stale {
+			if err := m.Load(); err != nil {
+				return nil, err
+			}
+			key = m.lookup(kid)
+		}
+	}
+
+	if key == nil || !key.usable(time.Now()) {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != key.alg {
+		return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+	}
+
+	return key.public, nil
+}
+
+func (m *KeyManager) lookup(kid string) *signingKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.keys[kid]
+}
+
+// JWKS returns the public keys that can currently verify tokens, as a JSON Web Key Set
+func (m *KeyManager) JWKS() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range m.keys {
+		if key.usable(now) {
+			set.Keys = append(set.Keys, newJWK(key))
+		}
+	}
+	return set
+}
+
+// generateSigningKey creates a new key pair for the algorithm
+func generateSigningKey(alg string) (*models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+
+	switch alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := NewID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		Kid:        kid,
+		Algorithm:  alg,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}, nil
+}
+
+// parseSigningKey decodes the PEM encoded key pair of a stored key
+func parseSigningKey(row models.SigningKey) (*signingKey, error) {
+	block, _ := pem.Decode([]byte(row.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid private key PEM")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{
+		kid:       row.Kid,
+		alg:       row.Algorithm,
+		createdAt: row.CreatedAt,
+		retiredAt: row.RetiredAt,
+		expiresAt: row.ExpiresAt,
+	}
+
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		if row.Algorithm != AlgRS256 {
+			return nil, fmt.Errorf("RSA key stored with algorithm %s", row.Algorithm)
+		}
+		key.method = jwt.SigningMethodRS256
+		key.private = private
+	case ed25519.PrivateKey:
+		if row.Algorithm != AlgEdDSA {
+			return nil, fmt.Errorf("Ed25519 key stored with algorithm %s", row.Algorithm)
+		}
+		key.method = jwt.SigningMethodEdDSA
+		key.private = private
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+
+	key.public = key.private.Public()
+	return key, nil
+}
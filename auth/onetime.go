@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidOneTimeToken is returned for unknown, expired or already used one-time tokens
+var ErrInvalidOneTimeToken = errors.New("invalid or expired token")
+
+// IssueOneTimeToken creates a token for the user and purpose that is valid for ttl.
+// Earlier unused tokens for the same purpose are discarded, so only the most
+// recently sent link works.
+func IssueOneTimeToken(userID int, purpose string, ttl time.Duration) (string, error) {
+	raw, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Delete(&models.OneTimeToken{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.OneTimeToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: HashToken(raw),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// ConsumeOneTimeToken marks the token as used and returns it. It fails if the
+// token does not exist, belongs to another purpose, has expired or has already
+// been used, including when two requests race to use it.
+func ConsumeOneTimeToken(tx *gorm.DB, raw, purpose string) (*models.OneTimeToken, error) {
+	var token models.OneTimeToken
+	err := tx.Where("token_hash = ? AND purpose = ?", HashToken(raw), purpose).First(&token).Error
+	if err != nil {
+		return nil, ErrInvalidOneTimeToken
+	}
+
+	now := time.Now()
+	if token.UsedAt != nil || now.After(token.ExpiresAt) {
+		return nil, ErrInvalidOneTimeToken
+	}
+
+	result := tx.Model(&models.OneTimeToken{}).
+		Where("id = ? AND used_at IS NULL", token.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidOneTimeToken
+	}
+
+	token.UsedAt = &now
+	return &token, nil
+}
+
+// FindOneTimeToken returns the token if it is valid, without consuming it.
+// It is used for tokens that allow retries, such as MFA challenges.
+func FindOneTimeToken(raw, purpose string) (*models.OneTimeToken, error) {
+	var token models.OneTimeToken
+	err := db.DB.Where("token_hash = ? AND purpose = ?", HashToken(raw), purpose).First(&token).Error
+	if err != nil {
+		return nil, ErrInvalidOneTimeToken
+	}
+
+	if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidOneTimeToken
+	}
+
+	return &token, nil
+}
+
+// RecordFailedAttempt counts a failed use of the token. Once maxAttempts is
+// reached the token is marked as used and cannot be tried again.
+func RecordFailedAttempt(token *models.OneTimeToken, maxAttempts int) error {
+	updates := map[string]interface{}{"attempts": gorm.Expr("attempts + 1")}
+	if token.Attempts+1 >= maxAttempts {
+		updates["used_at"] = time.Now()
+	}
+
+	return db.DB.Model(&models.OneTimeToken{}).Where("id = ?", token.ID).Updates(updates).Error
+}
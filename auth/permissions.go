@@ -0,0 +1,86 @@
+package auth
+
+import "github.com/raihan1405/go-restapi/models"
+
+// Permissions that route groups can require through middleware.RequirePermission
+const (
+	PermProductWrite    = "product:write"
+	PermProductWriteAny = "product:write:any"
+	PermRoleManage      = "role:manage"
+	PermUserManage      = "user:manage"
+	PermKeyManage       = "key:manage"
+	PermAuditRead       = "audit:read"
+	PermUserImpersonate = "user:impersonate"
+	PermCategoryManage  = "category:manage"
+	PermProfileRead     = "profile:read"
+	PermCartManage      = "cart:manage"
+)
+
+// basePermissions are granted to every user whatever their roles. They exist
+// so that API keys have to be scoped to them: every route an API key can reach
+// requires a permission, which keeps scoped keys denied by default.
+var basePermissions = []string{
+	PermProfileRead,
+	PermCartManage,
+}
+
+// rolePermissions maps each role to the permissions it grants
+var rolePermissions = map[string][]string{
+	models.RoleAdmin: {
+		PermProductWrite,
+		PermProductWriteAny,
+		PermRoleManage,
+		PermUserManage,
+		PermKeyManage,
+		PermAuditRead,
+		PermUserImpersonate,
+		PermCategoryManage,
+	},
+	models.RoleSeller: {
+		PermProductWrite,
+	},
+	models.RoleCustomer: {},
+}
+
+// IsPermission reports whether the name is a known permission, which is what
+// API key scopes are validated against
+func IsPermission(name string) bool {
+	if contains(basePermissions, name) {
+		return true
+	}
+	for _, permissions := range rolePermissions {
+		if contains(permissions, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether any of the principal's roles grants the permission, or
+// it is a base permission. Principals authenticated with a scoped API key also
+// need the permission in the key's scopes.
+func (p *Principal) Can(permission string) bool {
+	if p.Scopes != nil && !contains(p.Scopes, permission) {
+		return false
+	}
+
+	if contains(basePermissions, permission) {
+		return true
+	}
+
+	for _, role := range p.Roles {
+		if contains(rolePermissions[role], permission) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
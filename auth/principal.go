@@ -0,0 +1,50 @@
+package auth
+
+import "github.com/gofiber/fiber/v2"
+
+// principalKey is the fiber.Ctx locals key under which the principal is stored
+const principalKey = "principal"
+
+// Principal is the authenticated caller of a request, set by the auth middleware.
+// Requests authenticated with an API key have no session; they carry the
+// key's ID and, if the key is restricted, its scopes. In an impersonation
+// session UserID is the impersonated user and ImpersonatorID the admin.
+type Principal struct {
+	UserID         int
+	Roles          []string
+	SessionID      string
+	APIKeyID       int
+	Scopes         []string
+	ImpersonatorID int
+}
+
+// ViaAPIKey reports whether the request was authenticated with an API key
+func (p *Principal) ViaAPIKey() bool {
+	return p.APIKeyID != 0
+}
+
+// Impersonating reports whether an admin is acting as the user
+func (p *Principal) Impersonating() bool {
+	return p.ImpersonatorID != 0
+}
+
+// HasRole reports whether the principal has been granted the given role
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPrincipal stores the principal on the request context
+func SetPrincipal(c *fiber.Ctx, p *Principal) {
+	c.Locals(principalKey, p)
+}
+
+// GetPrincipal returns the principal of the request, if the request has been authenticated
+func GetPrincipal(c *fiber.Ctx) (*Principal, bool) {
+	p, ok := c.Locals(principalKey).(*Principal)
+	return p, ok && p != nil
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is
+	// presented again. The whole session is revoked when this happens.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// TokenPair is the result of a login or a refresh
+type TokenPair struct {
+	SessionID        string
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// AccessTokenTTL is how long access tokens are valid, from ACCESS_TOKEN_TTL (default 15m)
+func AccessTokenTTL() time.Duration {
+	return durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// RefreshTokenTTL is how long refresh tokens are valid, from REFRESH_TOKEN_TTL (default 30 days)
+func RefreshTokenTTL() time.Duration {
+	return durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// HashToken returns the hex SHA-256 of an opaque token, which is what gets stored
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewOpaqueToken returns a random URL-safe token with 256 bits of entropy
+func NewOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// StartSession creates a new session for the user and issues its first token
+// pair. Pass db.DB or the transaction the login is part of.
+func StartSession(tx *gorm.DB, userID int, userAgent, ip string) (*TokenPair, error) {
+	now := time.Now()
+	return startSession(tx, models.Session{
+		UserID:     userID,
+		UserAgent:  truncate(userAgent, 255),
+		IPAddress:  ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL()),
+	})
+}
+
+// startSession stores the session under a new ID and issues its first token pair
+func startSession(tx *gorm.DB, session models.Session) (*TokenPair, error) {
+	var err error
+	if session.ID, err = NewID(); err != nil {
+		return nil, err
+	}
+
+	var pair *TokenPair
+	err = tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		pair, err = issueTokenPair(tx, &session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// RefreshSession rotates a refresh token: the presented token is marked as
+// used and a new pair is issued for the same session. Presenting a token that
+// has already been used revokes the session, since either the client or an
+// attacker holds a stolen copy.
+func RefreshSession(rawToken, userAgent, ip string) (*TokenPair, error) {
+	var pair *TokenPair
+	reused := false
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var token models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Session").
+			Where("token_hash = ?", HashToken(rawToken)).
+			First(&token).Error
+		if err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		now := time.Now()
+		if token.UsedAt != nil {
+			reused = true
+			return revokeSession(tx, token.SessionID, now)
+		}
+
+		if !token.Session.Active() || now.After(token.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = true
+			return revokeSession(tx, token.SessionID, now)
+		}
+
+		session := token.Session
+		session.UserAgent = truncate(userAgent, 255)
+		session.IPAddress = ip
+		session.LastSeenAt = now
+		// Impersonation sessions end at the time they were opened for
+		if !session.Impersonated() {
+			session.ExpiresAt = now.Add(RefreshTokenTTL())
+		}
+		if err := tx.Save(&session).Error; err != nil {
+			return err
+		}
+
+		pair, err = issueTokenPair(tx, &session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, ErrRefreshTokenReused
+	}
+
+	return pair, nil
+}
+
+// RevokeSession revokes the session and with it every refresh token it issued
+func RevokeSession(tx *gorm.DB, sessionID string) error {
+	return revokeSession(tx, sessionID, time.Now())
+}
+
+func revokeSession(tx *gorm.DB, sessionID string, at time.Time) error {
+	return tx.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", at).Error
+}
+
+// RevokeUserSessions revokes every active session of the user except keepSessionID,
+// which may be empty to revoke all of them. It returns the number of sessions revoked.
+// Pass db.DB as tx when there is no surrounding transaction.
+func RevokeUserSessions(tx *gorm.DB, userID int, keepSessionID string) (int64, error) {
+	query := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if keepSessionID != "" {
+		query = query.Where("id <> ?", keepSessionID)
+	}
+
+	result := query.Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// issueTokenPair stores a new refresh token for the session and signs a matching access token
+func issueTokenPair(tx *gorm.DB, session *models.Session) (*TokenPair, error) {
+	raw, err := NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	refresh := models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: HashToken(raw),
+		ExpiresAt: session.ExpiresAt,
+	}
+	if err := tx.Create(&refresh).Error; err != nil {
+		return nil, err
+	}
+
+	// No access token outlives its session
+	accessTTL := AccessTokenTTL()
+	if remaining := time.Until(session.ExpiresAt); remaining < accessTTL {
+		accessTTL = remaining
+	}
+	access, err := IssueAccessToken(session, accessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		SessionID:        session.ID,
+		AccessToken:      access,
+		AccessExpiresAt:  time.Now().Add(accessTTL),
+		RefreshToken:     raw,
+		RefreshExpiresAt: refresh.ExpiresAt,
+	}, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/raihan1405/go-restapi/models"
+)
+
+// Claims are the claims carried by the access token set in the jwt cookie.
+// The subject is the user ID and the token ID is the session ID. Tokens of an
+// impersonation session name the admin behind them in the act claim (RFC 8693).
+type Claims struct {
+	jwt.RegisteredClaims
+	Actor *ActorClaim `json:"act,omitempty"`
+}
+
+// ActorClaim identifies who is really acting when a token is used on behalf of its subject
+type ActorClaim struct {
+	Subject string `json:"sub"`
+}
+
+// NewID returns a random hex identifier suitable for token and session IDs
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// IssueAccessToken signs an access token for the user of the session that is
+// valid for ttl, using the current key of the key manager
+func IssueAccessToken(session *models.Session, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(session.UserID),
+			ID:        session.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	if session.Impersonated() {
+		claims.Actor = &ActorClaim{Subject: strconv.Itoa(*session.ImpersonatorID)}
+	}
+
+	return Keys.Sign(claims)
+}
@@ -0,0 +1,29 @@
+package auth
+
+import "os"
+
+// Actions that EMAIL_VERIFICATION_POLICY can require a verified email for
+const (
+	VerifyBeforeLogin    = "login"
+	VerifyBeforeCheckout = "checkout"
+)
+
+// VerificationRequiredFor reports whether the EMAIL_VERIFICATION_POLICY
+// requires a verified email before the action. The policy is one of
+//
+//	none      unverified accounts can do everything (default)
+//	checkout  unverified accounts can log in but cannot check out, which
+//	          covers adding products to the cart and changing quantities
+//	login     unverified accounts cannot log in at all
+//
+// A policy that blocks login also blocks checkout.
+func VerificationRequiredFor(action string) bool {
+	switch os.Getenv("EMAIL_VERIFICATION_POLICY") {
+	case VerifyBeforeLogin:
+		return true
+	case VerifyBeforeCheckout:
+		return action == VerifyBeforeCheckout
+	default:
+		return false
+	}
+}
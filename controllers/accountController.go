@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/account"
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/validators"
+	"gorm.io/gorm"
+)
+
+// recentLoginWindow is how recently an account without a password must have
+// logged in to confirm a sensitive change, such as deleting the account
+const recentLoginWindow = 5 * time.Minute
+
+// reauthenticate writes a 401 response unless the user has just proven who
+// they are: with their password or, for accounts without one, by a session
+// started within recentLoginWindow. action completes "Log in again, then ..."
+// in the error. It reports whether it wrote a response.
+func reauthenticate(c *fiber.Ctx, principal *auth.Principal, user *models.User, password, action string) (bool, error) {
+	if len(user.Password) > 0 {
+		if checkPassword(user, password) {
+			return false, nil
+		}
+		return true, c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Incorrect password", "Password is incorrect"})
+	}
+
+	var session models.Session
+	err := db.DB.Where("id = ?", principal.SessionID).First(&session).Error
+	if err == nil && time.Since(session.CreatedAt) <= recentLoginWindow {
+		return false, nil
+	}
+	return true, c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Re-authentication required", fmt.Sprintf("This account has no password. Log in again, then %s within %d minutes", action, int(recentLoginWindow.Minutes()))})
+}
+
+// AccountDeletionResponse tells the user until when the account can be restored
+type AccountDeletionResponse struct {
+	Message  string    `json:"message"`
+	DeleteAt time.Time `json:"deleteAt"`
+}
+
+// ExportAccount godoc
+// @Summary Export personal data
+// @Description Download everything stored about the authenticated user: profile, linked identities, sessions, API keys, cart and products. Secrets such as password and token hashes are not included.
+// @Tags user
+// @Produce json
+// @Produce application/zip
+// @Param format query string false "json (default) or zip"
+// @Success 200 {object} account.Export
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/user/export [get]
+func ExportAccount(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	format := c.Query("format", "json")
+	if format != "json" && format != "zip" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid format", "format must be json or zip"})
+	}
+
+	export, err := account.BuildExport(principal.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot export account", err.Error()})
+	}
+
+	filename := fmt.Sprintf("account-%d-%s.%s", principal.UserID, export.ExportedAt.Format("20060102"), format)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+
+	if format == "json" {
+		return c.JSON(export)
+	}
+
+	var archive bytes.Buffer
+	if err := export.WriteZip(&archive); err != nil {
+		c.Set(fiber.HeaderContentDisposition, "")
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot export account", err.Error()})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	return c.Send(archive.Bytes())
+}
+
+// DeleteAccount godoc
+// @Summary Delete the account
+// @Description Schedule the authenticated user's account for deletion after re-entering the password, plus a TOTP or recovery code when two-factor authentication is enabled. Accounts without a password, such as those created through a social login, confirm with a fresh login instead: the current session must have started less than 5 minutes ago. All sessions and API keys are revoked. Logging in again before deleteAt restores the account; after that the personal data is purged. Products are kept as deleted without their seller, so carts can show them as unavailable. Audit events about the account are kept with its user ID, but without the email, phone number, username, and the IP addresses and user agents of the user's own actions.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param account body validators.DeleteAccountInput true "Password and, with 2FA, a code"
+// @Success 200 {object} AccountDeletionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/user [delete]
+func DeleteAccount(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	var data validators.DeleteAccountInput
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, principal.UserID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	if ok, resp := reauthenticate(c, principal, &user, data.Password, "delete the account"); ok {
+		return resp
+	}
+
+	if user.MFAEnabled() && !checkSecondFactor(&user, data.Code, data.RecoveryCode) {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Invalid code", "The code is incorrect or has already been used"})
+	}
+
+	var deleteAt time.Time
+	err := db.DB.Transaction(func(tx *gorm.DB) (err error) {
+		if deleteAt, err = account.ScheduleDeletion(tx, user.ID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action:  "user.deletion_schedule",
+			Target:  userTarget(user.ID),
+			Details: fiber.Map{"deleteAt": deleteAt},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot delete account", err.Error()})
+	}
+
+	clearSessionCookies(c)
+	return c.JSON(AccountDeletionResponse{
+		Message:  "Account scheduled for deletion. Log in again before deleteAt to keep it.",
+		DeleteAt: deleteAt,
+	})
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/dto"
+	"github.com/raihan1405/go-restapi/lockout"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/validators"
+	"gorm.io/gorm"
+)
+
+// GrantRole godoc
+// @Summary Grant a role to a user
+// @Description Grant the admin, seller or customer role to a user
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param role body validators.RoleInput true "Role to grant"
+// @Success 200 {array} dto.Role
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/roles [post]
+func GrantRole(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid user ID", err.Error()})
+	}
+
+	var data validators.RoleInput
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	var role models.Role
+	if err := db.DB.Where("name = ?", data.Role).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"role not found", "No role with the given name"})
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Association("Roles").Append(&role); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action:  "user.role_grant",
+			Target:  userTarget(user.ID),
+			Details: fiber.Map{"role": role.Name},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot grant role", err.Error()})
+	}
+
+	return userRoles(c, user)
+}
+
+// RevokeRole godoc
+// @Summary Revoke a role from a user
+// @Description Revoke a role from a user. Admins cannot revoke their own admin role.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Param role path string true "Role name"
+// @Success 200 {array} dto.Role
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/roles/{role} [delete]
+func RevokeRole(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid user ID", err.Error()})
+	}
+
+	roleName := c.Params("role")
+	if userID == principal.UserID && roleName == models.RoleAdmin {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot revoke role", "Admins cannot revoke their own admin role"})
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	var role models.Role
+	if err := db.DB.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"role not found", "No role with the given name"})
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Association("Roles").Delete(&role); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action:  "user.role_revoke",
+			Target:  userTarget(user.ID),
+			Details: fiber.Map{"role": role.Name},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot revoke role", err.Error()})
+	}
+
+	return userRoles(c, user)
+}
+
+// UnlockUser godoc
+// @Summary Unlock a user account
+// @Description Clear the failed login counter of a user so they can log in again immediately
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/unlock [post]
+func UnlockUser(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid user ID", err.Error()})
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	if err := lockout.Accounts.Reset(validators.NormalizeEmail(user.Email)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot unlock user", err.Error()})
+	}
+
+	if err := audit.Record(db.DB, auditActor(c), audit.Event{Action: "user.unlock", Target: userTarget(user.ID)}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot unlock user", err.Error()})
+	}
+
+	return c.JSON(SuccessResponse{Message: "User unlocked"})
+}
+
+// userRoles responds with the roles currently granted to the user
+func userRoles(c *fiber.Ctx, user models.User) error {
+	var roles []models.Role
+	if err := db.DB.Model(&user).Association("Roles").Find(&roles); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve roles", err.Error()})
+	}
+
+	return c.JSON(dto.NewRoles(roles))
+}
@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/dto"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/validators"
+	"gorm.io/gorm"
+)
+
+// AdminUserListResponse is one page of users
+type AdminUserListResponse struct {
+	Users []dto.AdminUser `json:"users"`
+	Page  int             `json:"page"`
+	Limit int             `json:"limit"`
+	Total int64           `json:"total"`
+}
+
+// likeEscaper escapes the LIKE wildcards in user input
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ListUsers godoc
+// @Summary List users
+// @Description Search users by email, username or phone number, one page at a time
+// @Tags admin
+// @Produce json
+// @Param q query string false "Part of the email, username or phone number"
+// @Param page query int false "Page number, from 1" default(1)
+// @Param limit query int false "Users per page, at most 100" default(20)
+// @Success 200 {object} AdminUserListResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users [get]
+func ListUsers(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := db.DB.Model(&models.User{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := "%" + likeEscaper.Replace(q) + "%"
+		query = query.Where("email LIKE ? OR username LIKE ? OR phone_number LIKE ?", pattern, pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve users", err.Error()})
+	}
+
+	var users []models.User
+	err := query.Preload("Roles").Order("id").Offset((page - 1) * limit).Limit(limit).Find(&users).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve users", err.Error()})
+	}
+
+	response := AdminUserListResponse{Users: make([]dto.AdminUser, 0, len(users)), Page: page, Limit: limit, Total: total}
+	for _, user := range users {
+		response.Users = append(response.Users, dto.NewAdminUser(user))
+	}
+
+	return c.JSON(response)
+}
+
+// GetUserDetails godoc
+// @Summary Get a user
+// @Description Get a user with their roles, account state, active sessions and API keys, and linked login providers
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} dto.AdminUserDetail
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id} [get]
+func GetUserDetails(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid user ID", err.Error()})
+	}
+
+	var user models.User
+	if err := db.DB.Preload("Roles").First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	now := time.Now()
+	detail := dto.AdminUserDetail{AdminUser: dto.NewAdminUser(user), MFAEnabled: user.MFAEnabled(), Providers: []string{}}
+
+	err = db.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, now).
+		Count(&detail.ActiveSessions).Error
+	if err == nil {
+		err = db.DB.Model(&models.APIKey{}).
+			Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", user.ID, now).
+			Count(&detail.ActiveAPIKeys).Error
+	}
+	if err == nil {
+		err = db.DB.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Order("provider").Pluck("provider", &detail.Providers).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve user", err.Error()})
+	}
+
+	return c.JSON(detail)
+}
+
+// DisableUser godoc
+// @Summary Disable a user
+// @Description Disable a user account. The user is logged out everywhere and can no longer log in or use API keys until the account is enabled again.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/disable [post]
+func DisableUser(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid user ID", err.Error()})
+	}
+
+	if userID == principal.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot disable user", "Admins cannot disable their own account"})
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	now, disabledAt := time.Now(), user.DisabledAt
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("disabled_at", now).Error; err != nil {
+			return err
+		}
+
+		revoked, err := auth.RevokeUserSessions(tx, user.ID, "")
+		if err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action:  "user.disable",
+			Target:  userTarget(user.ID),
+			Before:  fiber.Map{"disabledAt": disabledAt},
+			After:   fiber.Map{"disabledAt": now},
+			Details: fiber.Map{"revokedSessions": revoked},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot disable user", err.Error()})
+	}
+
+	return c.JSON(SuccessResponse{Message: "User disabled"})
+}
+
+// EnableUser godoc
+// @Summary Enable a user
+// @Description Enable a user account that was disabled
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/enable [post]
+func EnableUser(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid user ID", err.Error()})
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	disabledAt := user.DisabledAt
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("disabled_at", nil).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "user.enable",
+			Target: userTarget(user.ID),
+			Before: fiber.Map{"disabledAt": disabledAt},
+			After:  fiber.Map{"disabledAt": nil},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot enable user", err.Error()})
+	}
+
+	return c.JSON(SuccessResponse{Message: "User enabled"})
+}
+
+// ForceLogoutUser godoc
+// @Summary Log a user out everywhere
+// @Description Revoke every session of a user. API keys are not affected.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} RevokedSessionsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/logout [post]
+func ForceLogoutUser(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid user ID", err.Error()})
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	var revoked int64
+	err = db.DB.Transaction(func(tx *gorm.DB) (err error) {
+		revoked, err = auth.RevokeUserSessions(tx, user.ID, "")
+		if err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action:  "user.logout",
+			Target:  userTarget(user.ID),
+			Details: fiber.Map{"revokedSessions": revoked},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot revoke sessions", err.Error()})
+	}
+
+	return c.JSON(RevokedSessionsResponse{Message: "User logged out everywhere", Revoked: revoked})
+}
+
+// ResetUserMFA godoc
+// @Summary Reset two-factor authentication of a user
+// @Description Turn off two-factor authentication and delete the recovery codes of a user who lost their authenticator
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/mfa/reset [post]
+func ResetUserMFA(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid user ID", err.Error()})
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	if !user.MFAEnabled() && user.TOTPPendingSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Not enabled", "Two-factor authentication is not enabled"})
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := disableMFA(tx, user.ID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "user.mfa_reset",
+			Target: userTarget(user.ID),
+			Before: fiber.Map{"mfaEnabled": user.MFAEnabled()},
+			After:  fiber.Map{"mfaEnabled": false},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot reset two-factor authentication", err.Error()})
+	}
+
+	return c.JSON(SuccessResponse{Message: "Two-factor authentication reset"})
+}
+
+// ChangeUserRole godoc
+// @Summary Change the role of a user
+// @Description Replace all roles of a user with the given role. Admins cannot change their own role.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param role body validators.RoleInput true "New role"
+// @Success 200 {array} dto.Role
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/role [put]
+func ChangeUserRole(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid user ID", err.Error()})
+	}
+
+	var data validators.RoleInput
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	if userID == principal.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot change role", "Admins cannot change their own role"})
+	}
+
+	var user models.User
+	if err := db.DB.Preload("Roles").First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	var role models.Role
+	if err := db.DB.Where("name = ?", data.Role).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"role not found", "No role with the given name"})
+	}
+
+	previous := user.RoleNames()
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Association("Roles").Replace(&role); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "user.role_change",
+			Target: userTarget(user.ID),
+			Before: fiber.Map{"roles": previous},
+			After:  fiber.Map{"roles": []string{role.Name}},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot change role", err.Error()})
+	}
+
+	return userRoles(c, user)
+}
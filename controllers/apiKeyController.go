@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/validators"
+	"gorm.io/gorm"
+)
+
+const (
+	// apiKeyAttempts is how often a key is generated before giving up on
+	// finding an unused prefix
+	apiKeyAttempts = 3
+	// apiKeyPrefixIndex is the unique index on API key prefixes
+	apiKeyPrefixIndex = "idx_api_keys_prefix"
+)
+
+// APIKeyResponse describes an API key without its secret
+type APIKeyResponse struct {
+	models.APIKey
+	Scopes []string `json:"scopes"`
+}
+
+// CreatedAPIKeyResponse contains the full key, which is only shown once
+type CreatedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+func newAPIKeyResponse(key models.APIKey) APIKeyResponse {
+	return APIKeyResponse{APIKey: key, Scopes: key.ScopeList()}
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Create a personal API key for server-to-server clients, sent as "Authorization: Bearer <key>". Scopes restrict the key to a subset of the user's permissions. The key is only returned once.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param key body validators.CreateAPIKeyInput true "API key details"
+// @Success 200 {object} CreatedAPIKeyResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/user/api-keys [post]
+func CreateAPIKey(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	var data validators.CreateAPIKeyInput
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	for _, scope := range data.Scopes {
+		if !auth.IsPermission(scope) {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", "Unknown scope " + scope})
+		}
+	}
+
+	if data.ExpiresAt != nil && !data.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", "expiresAt must be in the future"})
+	}
+
+	var key string
+	var err error
+	var apiKey models.APIKey
+	// Prefixes are random, so a clash with an existing key is unlikely but
+	// possible; a new key is generated then
+	for attempt := 0; attempt < apiKeyAttempts; attempt++ {
+		var prefix string
+		key, prefix, err = auth.NewAPIKey()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot generate API key", err.Error()})
+		}
+
+		apiKey = models.APIKey{
+			UserID:    principal.UserID,
+			Name:      data.Name,
+			Prefix:    prefix,
+			KeyHash:   auth.HashToken(key),
+			Scopes:    strings.Join(data.Scopes, ","),
+			ExpiresAt: data.ExpiresAt,
+		}
+		err = db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&apiKey).Error; err != nil {
+				return err
+			}
+
+			return audit.Record(tx, auditActor(c), audit.Event{
+				Action: "api_key.create",
+				Target: apiKeyTarget(apiKey.ID),
+				After:  newAPIKeyResponse(apiKey),
+			})
+		})
+		if index, ok := db.DuplicateKey(err); !ok || index != apiKeyPrefixIndex {
+			break
+		}
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot save API key", err.Error()})
+	}
+
+	return c.JSON(CreatedAPIKeyResponse{APIKeyResponse: newAPIKeyResponse(apiKey), Key: key})
+}
+
+// GetAPIKeys godoc
+// @Summary List API keys
+// @Description List the API keys of the authenticated user, including revoked and expired ones
+// @Tags api-keys
+// @Produce json
+// @Success 200 {array} APIKeyResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/user/api-keys [get]
+func GetAPIKeys(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	var keys []models.APIKey
+	if err := db.DB.Where("user_id = ?", principal.UserID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve API keys", err.Error()})
+	}
+
+	response := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, newAPIKeyResponse(key))
+	}
+
+	return c.JSON(response)
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Revoke one of the authenticated user's API keys
+// @Tags api-keys
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/user/api-keys/{id} [delete]
+func RevokeAPIKey(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid API key ID", err.Error()})
+	}
+
+	var key models.APIKey
+	if err := db.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, principal.UserID).First(&key).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"API key not found", "No active API key with the given ID"})
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&key).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action:  "api_key.revoke",
+			Target:  apiKeyTarget(key.ID),
+			Details: fiber.Map{"prefix": key.Prefix, "name": key.Name},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot revoke API key", err.Error()})
+	}
+
+	return c.JSON(SuccessResponse{Message: "API key revoked"})
+}
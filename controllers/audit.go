@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/models"
+)
+
+// auditActor describes the caller of the request for the audit log
+func auditActor(c *fiber.Ctx) audit.Actor {
+	actor := audit.Actor{
+		IPAddress: c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+	if id, ok := c.Locals(requestid.ConfigDefault.ContextKey).(string); ok {
+		actor.RequestID = id
+	}
+	if principal, ok := auth.GetPrincipal(c); ok {
+		userID := principal.UserID
+		actor.UserID = &userID
+		if principal.Impersonating() {
+			impersonatorID := principal.ImpersonatorID
+			actor.ImpersonatorID = &impersonatorID
+		}
+	}
+	return actor
+}
+
+// userActor describes the caller of a request that acts as the given user
+// without being authenticated yet, such as a login or a registration
+func userActor(c *fiber.Ctx, userID int) audit.Actor {
+	actor := auditActor(c)
+	actor.UserID = &userID
+	return actor
+}
+
+// userTarget is a user as the target of an audited action
+func userTarget(userID int) audit.Target {
+	return audit.Target{Type: "user", ID: strconv.Itoa(userID)}
+}
+
+// productTarget is a product as the target of an audited action
+func productTarget(productID int) audit.Target {
+	return audit.Target{Type: "product", ID: strconv.Itoa(productID)}
+}
+
+// apiKeyTarget is an API key as the target of an audited action
+func apiKeyTarget(keyID int) audit.Target {
+	return audit.Target{Type: "api_key", ID: strconv.Itoa(keyID)}
+}
+
+// sessionTarget is a login session as the target of an audited action
+func sessionTarget(sessionID string) audit.Target {
+	return audit.Target{Type: "session", ID: sessionID}
+}
+
+// cartItemTarget is a cart line as the target of an audited action
+func cartItemTarget(itemID int) audit.Target {
+	return audit.Target{Type: "cart_item", ID: strconv.Itoa(itemID)}
+}
+
+// cartItemState is the audited state of a cart line
+func cartItemState(item models.CartItem) fiber.Map {
+	return fiber.Map{"productId": item.ProductID, "quantity": item.Quantity}
+}
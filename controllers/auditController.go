@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+)
+
+// AuditEventListResponse is one page of audit events, newest first
+type AuditEventListResponse struct {
+	Events []models.AuditEvent `json:"events"`
+	Page   int                 `json:"page"`
+	Limit  int                 `json:"limit"`
+	Total  int64               `json:"total"`
+}
+
+// ListAuditEvents godoc
+// @Summary List audit events
+// @Description Search the audit log by actor, target and time range, newest first
+// @Tags admin
+// @Produce json
+// @Param actor query int false "ID of the user who performed the action, directly or by impersonating another user"
+// @Param target_type query string false "Target type, such as user, product or cart_item"
+// @Param target_id query string false "Target ID, together with target_type"
+// @Param action query string false "Action, such as user.disable"
+// @Param from query string false "Earliest time, RFC 3339"
+// @Param to query string false "Latest time, RFC 3339"
+// @Param page query int false "Page number, from 1" default(1)
+// @Param limit query int false "Events per page, at most 100" default(50)
+// @Success 200 {object} AuditEventListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/audit-events [get]
+func ListAuditEvents(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := db.DB.Model(&models.AuditEvent{})
+
+	if actor := c.Query("actor"); actor != "" {
+		actorID, err := strconv.Atoi(actor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid actor", err.Error()})
+		}
+		// Includes what the actor did while impersonating other users
+		query = query.Where("actor_id = ? OR impersonator_id = ?", actorID, actorID)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+		if targetID := c.Query("target_id"); targetID != "" {
+			query = query.Where("target_id = ?", targetID)
+		}
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	for _, bound := range []struct{ param, condition string }{
+		{"from", "created_at >= ?"},
+		{"to", "created_at <= ?"},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid " + bound.param, "Use an RFC 3339 time such as 2024-01-02T15:04:05Z"})
+		}
+		query = query.Where(bound.condition, at)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve audit events", err.Error()})
+	}
+
+	events := []models.AuditEvent{}
+	err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&events).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve audit events", err.Error()})
+	}
+
+	return c.JSON(AuditEventListResponse{Events: events, Page: page, Limit: limit, Total: total})
+}
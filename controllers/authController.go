@@ -1,30 +1,42 @@
 package controllers
 
 import (
-	"os"
+	"errors"
+	"log"
+	"math"
 	"strconv"
+	"sync"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/account"
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
 	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/dto"
+	"github.com/raihan1405/go-restapi/lockout"
 	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/passwords"
 	"github.com/raihan1405/go-restapi/validators"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
-var secretKey = os.Getenv("JWT_SECRET")
+// refreshCookieName is the cookie that carries the refresh token
+const refreshCookieName = "refresh_token"
 
 // Definisikan struktur respons sukses
 type LoginResponse struct {
-	Message string `json:"message"`
-	Token   string `json:"token"`
-	User    struct {
-		ID          uint   `json:"id"`
-		Username    string `json:"username"`
-		Email       string `json:"email"`
-		PhoneNumber string `json:"phoneNumber"`
-	} `json:"user"`
+	Message      string `json:"message"`
+	Token        string `json:"token"`
+	RefreshToken string   `json:"refreshToken"`
+	User         dto.User `json:"user"`
+}
+
+// TokenResponse dikembalikan setelah refresh token berhasil
+type TokenResponse struct {
+	Message      string `json:"message"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
 }
 
 // Definisikan struktur respons kesalahan
@@ -35,51 +47,28 @@ type ErrorResponse struct {
 
 // GetUser godoc
 // @Summary Get authenticated user details
-// @Description Get details of the authenticated user based on the JWT token
+// @Description Get details of the authenticated user based on the JWT token. In an impersonation session the response names the admin acting as the user.
 // @Tags user
 // @Produce json
-// @Success 200 {object} models.User
+// @Success 200 {object} dto.User
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
 // @Router /api/user [get]
 func GetUser(c *fiber.Ctx) error {
-    // Retrieve the JWT token from the cookies
-    cookie := c.Cookies("jwt")
-
-    // Parse the JWT token and extract the claims
-    token, err := jwt.ParseWithClaims(cookie, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
-        return []byte(secretKey), nil
-    })
-
-    // Handle error if token is invalid or parsing fails
-    if err != nil || !token.Valid {
-        return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
-            Message: "unauthenticated",
-            Error:   "Invalid or expired token",
-        })
-    }
-
-    // Extract the claims and cast to the correct type
-    claims, ok := token.Claims.(*jwt.StandardClaims)
+    // Retrieve the principal set by the auth middleware
+    principal, ok := auth.GetPrincipal(c)
     if !ok {
         return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
             Message: "unauthenticated",
-            Error:   "Invalid token claims",
-        })
-    }
-
-    // Convert the Subject (which is the user ID in string format) to an integer
-    userID, err := strconv.Atoi(claims.Subject)
-    if err != nil {
-        return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
-            Message: "Invalid token",
-            Error:   "Token contains invalid user ID",
+            Error:   "Invalid or expired token",
         })
     }
 
-    // Retrieve the user from the database using the converted user ID
+    // Retrieve the user from the database using the principal's user ID
     var user models.User
-    db.DB.Where("id = ?", userID).First(&user)
+    db.DB.Preload("Roles").Where("id = ?", principal.UserID).First(&user)
 
     // If user is not found, return a 404 error
     if user.ID == 0 {
@@ -89,15 +78,36 @@ func GetUser(c *fiber.Ctx) error {
         })
     }
 
+    response := dto.NewUser(user)
+
+    // Make it obvious to the client that an admin is acting as the user
+    if principal.Impersonating() {
+        var session models.Session
+        var impersonator models.User
+        err := db.DB.Where("id = ?", principal.SessionID).First(&session).Error
+        if err == nil {
+            err = db.DB.First(&impersonator, principal.ImpersonatorID).Error
+        }
+        if err != nil {
+            return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve impersonation", err.Error()})
+        }
+
+        response.Impersonation = &dto.Impersonation{
+            ImpersonatorID:       impersonator.ID,
+            ImpersonatorUsername: impersonator.Username,
+            ExpiresAt:            session.ExpiresAt,
+        }
+    }
+
     // Return the user details as the response
-    return c.JSON(user)
+    return c.JSON(response)
 }
 
 
 
 // UpdatePassword godoc
 // @Summary Update user password
-// @Description Update user password with the provided old and new passwords
+// @Description Update user password with the provided old and new passwords. All other sessions are revoked unless revoke_other_sessions is false.
 // @Tags user
 // @Accept json
 // @Produce json
@@ -108,24 +118,13 @@ func GetUser(c *fiber.Ctx) error {
 // @Failure 404 {object} ErrorResponse
 // @Router /api/user/password [put]
 func UpdatePassword(c *fiber.Ctx) error {
-    cookie := c.Cookies("jwt")
-    token, err := jwt.ParseWithClaims(cookie, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
-        return []byte(secretKey), nil
-    })
-
-    if err != nil {
-        return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", err.Error()})
-    }
-    claims := token.Claims.(*jwt.StandardClaims)
-
-    // Convert claims.Subject to integer
-    userID, err := strconv.Atoi(claims.Subject)
-    if err != nil {
-        return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Invalid token", "Token contains invalid user ID"})
+    principal, ok := auth.GetPrincipal(c)
+    if !ok {
+        return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
     }
 
     var data validators.UpdatePasswordInput
-    err = c.BodyParser(&data)
+    err := c.BodyParser(&data)
     if err != nil {
         return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
     }
@@ -136,61 +135,78 @@ func UpdatePassword(c *fiber.Ctx) error {
     }
 
     var user models.User
-    db.DB.Where("id = ?", userID).First(&user)
+    db.DB.Where("id = ?", principal.UserID).First(&user)
     if user.ID == 0 {
         return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
     }
 
     // Verify old password
-    err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data.OldPassword))
-    if err != nil {
-        return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"incorrect old password", err.Error()})
+    if !checkPassword(&user, data.OldPassword) {
+        return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"incorrect old password", "Old password is incorrect"})
+    }
+
+    if err := passwords.Check(data.NewPassword); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Password does not meet the policy", err.Error()})
     }
 
     // Generate new hashed password
-    newPassword, err := bcrypt.GenerateFromPassword([]byte(data.NewPassword), 14)
+    newPassword, err := passwords.Hash(data.NewPassword)
     if err != nil {
         return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot hash new password", err.Error()})
     }
 
     user.Password = newPassword
-    db.DB.Save(&user)
 
-    return c.JSON(map[string]interface{}{"message": "password updated successfully"})
+    // Tokens issued before the change stay valid unless their sessions are revoked
+    var revoked int64
+    err = db.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Save(&user).Error; err != nil {
+            return err
+        }
+
+        if data.RevokeOtherSessions == nil || *data.RevokeOtherSessions {
+            if revoked, err = auth.RevokeUserSessions(tx, user.ID, principal.SessionID); err != nil {
+                return err
+            }
+        }
+
+        return audit.Record(tx, auditActor(c), audit.Event{
+            Action:  "user.password_change",
+            Target:  userTarget(user.ID),
+            Details: fiber.Map{"revokedSessions": revoked},
+        })
+    })
+    if err != nil {
+        return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot update password", err.Error()})
+    }
+
+    return c.JSON(map[string]interface{}{"message": "password updated successfully", "revokedSessions": revoked})
 }
 
 
 // UpdateProfile godoc
 // @Summary Update user details
-// @Description Update user details with the provided information
+// @Description Update user details with the provided information. Only possible in a login session, not with an API key or while impersonating.
 // @Tags user
 // @Accept json
 // @Produce json
 // @Param update body validators.UpdateUserInput true "User update details"
-// @Success 200 {object} models.User
+// @Success 200 {object} dto.User
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ConflictResponse
+// @Failure 500 {object} ErrorResponse
 // @Router /api/user [put]
 func UpdateProfile(c *fiber.Ctx) error {
-    cookie := c.Cookies("jwt")
-    token, err := jwt.ParseWithClaims(cookie, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
-        return []byte(secretKey), nil
-    })
-
-    if err != nil {
-        return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", err.Error()})
-    }
-    claims := token.Claims.(*jwt.StandardClaims)
-
-    // Convert claims.Subject to integer
-    userID, err := strconv.Atoi(claims.Subject)
-    if err != nil {
-        return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Invalid token", "Token contains invalid user ID"})
+    principal, ok := auth.GetPrincipal(c)
+    if !ok {
+        return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
     }
 
     var data validators.UpdateUserInput
-    err = c.BodyParser(&data)
+    err := c.BodyParser(&data)
     if err != nil {
         return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
     }
@@ -200,31 +216,67 @@ func UpdateProfile(c *fiber.Ctx) error {
         return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
     }
 
+    data.Email = validators.NormalizeEmail(data.Email)
+    data.PhoneNumber, err = validators.NormalizePhone(data.PhoneNumber)
+    if err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+    }
+
     var user models.User
-    db.DB.Where("id = ?", userID).First(&user)
+    db.DB.Where("id = ?", principal.UserID).First(&user)
     if user.ID == 0 {
         return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
     }
 
+    before := dto.NewUser(user)
+
+    // A new email address has to be verified again
+    emailChanged := user.Email != data.Email
+    if emailChanged {
+        user.VerifiedAt = nil
+    }
+
     user.Username = data.Username
     user.Email = data.Email
     user.PhoneNumber = data.PhoneNumber
 
-    db.DB.Save(&user)
+    err = db.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Save(&user).Error; err != nil {
+            return err
+        }
 
-    return c.JSON(user)
+        return audit.Record(tx, auditActor(c), audit.Event{
+            Action: "user.profile_update",
+            Target: userTarget(user.ID),
+            Before: before,
+            After:  dto.NewUser(user),
+        })
+    })
+    if err != nil {
+        if ok, resp := conflict(c, err); ok {
+            return resp
+        }
+        return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot update user", err.Error()})
+    }
+
+    if emailChanged {
+        go sendVerificationEmail(user)
+    }
+
+    return c.JSON(dto.NewUser(user))
 }
 
 
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user with the provided details
+// @Description Register a new user with the provided details and email a verification link
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param register body validators.RegisterInput true "User registration details"
-// @Success 200 {object} models.User
+// @Success 200 {object} dto.User
 // @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ConflictResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/register [post]
 func Register(c *fiber.Ctx) error {
@@ -242,36 +294,75 @@ func Register(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
 	}
 
+	data.Email = validators.NormalizeEmail(data.Email)
+	data.PhoneNumber, err = validators.NormalizePhone(data.PhoneNumber)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	if err := passwords.Check(data.Password); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Password does not meet the policy", err.Error()})
+	}
+
 	// Generate hashed password
-	password, err := bcrypt.GenerateFromPassword([]byte(data.Password), 14)
+	password, err := passwords.Hash(data.Password)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot hash password", err.Error()})
 	}
 
+	// New accounts start out as customers
+	var customer models.Role
+	if err := db.DB.Where("name = ?", models.RoleCustomer).First(&customer).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot assign role", err.Error()})
+	}
+
 	// Create user
 	user := models.User{
 		Username:    data.Username,
 		Email:       data.Email,
 		PhoneNumber: data.PhoneNumber,
 		Password:    password,
+		Roles:       []models.Role{customer},
 	}
 
 	// Save user to database
-	db.DB.Create(&user)
-	return c.JSON(user)
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, userActor(c, user.ID), audit.Event{
+			Action: "auth.register",
+			Target: userTarget(user.ID),
+			After:  dto.NewUser(user),
+		})
+	})
+	if err != nil {
+		if ok, resp := conflict(c, err); ok {
+			return resp
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot create user", err.Error()})
+	}
+
+	// Minta pengguna mengonfirmasi alamat emailnya
+	go sendVerificationEmail(user)
+
+	return c.JSON(dto.NewUser(user))
 }
 
 // Login godoc
 // @Summary Log in a user
-// @Description Log in a user with the provided credentials and return user data
+// @Description Log in a user with the provided credentials and return user data. Repeated failures lock the account and the client IP for an increasing time. Users with two-factor authentication get an MFA challenge token instead, to be completed at /api/login/mfa.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param login body validators.LoginInput true "User login details"
 // @Success 200 {object} LoginResponse
+// @Success 202 {object} MFAChallengeResponse
 // @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/login [post]
 func Login(c *fiber.Ctx) error {
@@ -289,77 +380,303 @@ func Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
 	}
 
+	// Tolak dulu jika akun atau IP sedang dikunci karena terlalu banyak percobaan gagal
+	accountKey := validators.NormalizeEmail(data.Email)
+	if locked, err := loginLockedFor(accountKey, c.IP()); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", err.Error()})
+	} else if locked > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(locked.Seconds()))))
+		return c.Status(fiber.StatusTooManyRequests).JSON(ErrorResponse{"Too many failed attempts", "Try again in " + locked.Round(time.Second).String()})
+	}
+
 	// Find user by email
 	var user models.User
-	db.DB.Where("email = ?", data.Email).First(&user)
+	db.DB.Where("email = ?", accountKey).First(&user)
 
-	// Check if user exists
+	// Compare password. Unknown emails are checked against a dummy hash so
+	// that both cases take as long and get the same response.
+	valid := false
 	if user.ID == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"User not found", "No user with the given email"})
+		passwords.Verify(dummyPasswordHash(), data.Password)
+	} else {
+		valid = checkPassword(&user, data.Password)
+	}
+	if !valid {
+		if err := recordLoginFailure(accountKey, c.IP()); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", err.Error()})
+		}
+
+		// Akun yang tidak dikenal dicatat dengan email yang dicoba
+		event := audit.Event{Action: "auth.login_failed", Target: audit.Target{Type: "user"}, Details: fiber.Map{"email": accountKey}}
+		if user.ID != 0 {
+			event.Target, event.Details = userTarget(user.ID), nil
+		}
+		if err := audit.Record(db.DB, auditActor(c), event); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", err.Error()})
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Invalid credentials", "Email or password is incorrect"})
+	}
+
+	// With two-factor authentication the counter is only reset once the
+	// second factor is correct, so wrong codes keep counting towards a lockout
+	if !user.MFAEnabled() {
+		if err := lockout.Accounts.Reset(accountKey); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", err.Error()})
+		}
+	}
+
+	// Depending on the verification policy, unverified accounts cannot log in yet
+	if !user.IsVerified() && auth.VerificationRequiredFor(auth.VerifyBeforeLogin) {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{"Email not verified", "Confirm your email address before logging in"})
+	}
+
+	return completeLogin(c, user)
+}
+
+// loginLockedFor returns how long logins for the account or from the IP are still locked
+func loginLockedFor(accountKey, ip string) (time.Duration, error) {
+	account, err := lockout.Accounts.Check(accountKey)
+	if err != nil {
+		return 0, err
 	}
 
-	// Compare password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data.Password))
+	address, err := lockout.IPs.Check(ip)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Incorrect password", err.Error()})
+		return 0, err
 	}
 
-	// Generate JWT token
-	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		Subject:   strconv.Itoa(int(user.ID)),
-		ExpiresAt: time.Now().Add(time.Hour * 24).Unix(), // Token expires in 24 hours
-	})
+	if address > account {
+		return address, nil
+	}
+	return account, nil
+}
 
-	token, err := claims.SignedString([]byte(secretKey))
+// recordLoginFailure counts a failed login against the account and the IP
+func recordLoginFailure(accountKey, ip string) error {
+	if err := lockout.Accounts.Fail(accountKey); err != nil {
+		return err
+	}
+	return lockout.IPs.Fail(ip)
+}
+
+// dummyPasswordHash is compared against when the email is unknown
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := passwords.Hash("dummy password for timing")
+	return hash
+})
+
+// checkPassword reports whether the password matches the user's stored hash.
+// A hash made with an outdated algorithm or cost is replaced on the way.
+func checkPassword(user *models.User, password string) bool {
+	ok, rehash, err := passwords.Verify(user.Password, password)
+	if err != nil || !ok {
+		return false
+	}
+
+	if rehash {
+		hash, err := passwords.Hash(password)
+		if err != nil {
+			log.Printf("cannot rehash password of user %d: %v", user.ID, err)
+			return true
+		}
+
+		// Only replace the hash that was checked, in case the password changed meanwhile
+		err = db.DB.Model(&models.User{}).
+			Where("id = ? AND password = ?", user.ID, user.Password).
+			Update("password", hash).Error
+		if err != nil {
+			log.Printf("cannot rehash password of user %d: %v", user.ID, err)
+			return true
+		}
+		user.Password = hash
+	}
+
+	return true
+}
+
+// completeLogin finishes a login once the first factor has been checked: users
+// with two-factor authentication get an MFA challenge, everyone else a session
+func completeLogin(c *fiber.Ctx, user models.User) error {
+	if user.IsDisabled() {
+		return accountDisabled(c)
+	}
+
+	if user.MFAEnabled() {
+		challenge, err := auth.IssueOneTimeToken(user.ID, models.TokenPurposeMFAChallenge, mfaChallengeTTL)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", err.Error()})
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(MFAChallengeResponse{
+			Message:        "Two-factor authentication required",
+			MFARequired:    true,
+			ChallengeToken: challenge,
+		})
+	}
+
+	return loginSuccess(c, user)
+}
+
+// accountDisabled rejects a login to an account an admin has disabled
+func accountDisabled(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{"Account disabled", "This account has been disabled by an administrator"})
+}
+
+// loginSuccess starts a server-side session, sets the token cookies and
+// returns user data along with the token
+func loginSuccess(c *fiber.Ctx, user models.User) error {
+	if user.IsDisabled() {
+		return accountDisabled(c)
+	}
+
+	// Logging in during the deletion grace period keeps the account
+	if user.DeletionScheduledAt != nil {
+		if err := account.CancelDeletion(user.ID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", err.Error()})
+		}
+		user.DeletionScheduledAt = nil
+	}
+
+	var pair *auth.TokenPair
+	err := db.DB.Transaction(func(tx *gorm.DB) (err error) {
+		pair, err = auth.StartSession(tx, user.ID, c.Get(fiber.HeaderUserAgent), c.IP())
+		if err != nil {
+			return err
+		}
+
+		return audit.Record(tx, userActor(c, user.ID), audit.Event{Action: "auth.login", Target: userTarget(user.ID)})
+	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", err.Error()})
 	}
 
-	// Set cookie with JWT token
-	cookie := fiber.Cookie{
-		Name:     "jwt",
-		Value:    token,
-		Expires:  time.Now().Add(time.Hour * 24),
-		HTTPOnly: true,
-        Secure:   true,  // This ensures the cookie is only sent over HTTPS
-        SameSite: "None", // Allows the cookie to be sent cross-domain
-	}
-	c.Cookie(&cookie)
+	setSessionCookies(c, pair)
 
-	// Return user data along with the token
 	return c.JSON(LoginResponse{
-		Message: "Login successful",
-		Token:   token,
-		User: struct {
-			ID          uint   `json:"id"`
-			Username    string `json:"username"`
-			Email       string `json:"email"`
-			PhoneNumber string `json:"phoneNumber"`
-		}{
-			ID:          uint(user.ID),
-			Username:    user.Username,
-			Email:       user.Email,
-			PhoneNumber: user.PhoneNumber,
-		},
+		Message:      "Login successful",
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		User:         dto.NewUser(user),
+	})
+}
+
+// RefreshToken godoc
+// @Summary Refresh the access token
+// @Description Exchange a refresh token (refresh_token cookie or request body) for a new access and refresh token. Each refresh token can only be used once; reusing one revokes the whole session.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param refresh body validators.RefreshTokenInput false "Refresh token, if not sent as cookie"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/token/refresh [post]
+func RefreshToken(c *fiber.Ctx) error {
+	var data validators.RefreshTokenInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&data); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+		}
+	}
+
+	raw := data.RefreshToken
+	if raw == "" {
+		raw = c.Cookies(refreshCookieName)
+	}
+	if raw == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Missing refresh token", "No refresh token in cookie or body"})
+	}
+
+	pair, err := auth.RefreshSession(raw, c.Get(fiber.HeaderUserAgent), c.IP())
+	if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+		clearSessionCookies(c)
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not refresh token", err.Error()})
+	}
+
+	setSessionCookies(c, pair)
+
+	return c.JSON(TokenResponse{
+		Message:      "Token refreshed",
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
 	})
 }
 
 // Logout godoc
 // @Summary Log out the authenticated user
-// @Description Log out the authenticated user by clearing the JWT cookie
+// @Description Log out the authenticated user by revoking the current session and clearing the token cookies. API keys cannot log out; revoke the key instead.
 // @Tags auth
 // @Produce json
 // @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
 // @Router /api/logout [post]
 func Logout(c *fiber.Ctx) error {
-	cookie := fiber.Cookie{
-		Name:     "jwt",
-		Value:    "",
-		Expires:  time.Now().Add(-time.Hour),
-		HTTPOnly: true,
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := auth.RevokeSession(tx, principal.SessionID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{Action: "auth.logout", Target: userTarget(principal.UserID)})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not logout", err.Error()})
 	}
 
-	c.Cookie(&cookie)
+	clearSessionCookies(c)
 
 	return c.JSON(map[string]interface{}{"message": "logout success"})
 }
+
+// setSessionCookies sets the access token cookie and the refresh token cookie,
+// which is only sent to the refresh endpoint
+func setSessionCookies(c *fiber.Ctx, pair *auth.TokenPair) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    pair.AccessToken,
+		Expires:  pair.AccessExpiresAt,
+		HTTPOnly: true,
+		Secure:   true,   // This ensures the cookie is only sent over HTTPS
+		SameSite: "None", // Allows the cookie to be sent cross-domain
+	})
+	c.Cookie(&fiber.Cookie{
+		Name:     refreshCookieName,
+		Value:    pair.RefreshToken,
+		Path:     "/api/token",
+		Expires:  pair.RefreshExpiresAt,
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: "None",
+	})
+}
+
+// clearSessionCookies expires both token cookies
+func clearSessionCookies(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    "",
+		Expires:  time.Now().Add(-time.Hour),
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: "None",
+	})
+	c.Cookie(&fiber.Cookie{
+		Name:     refreshCookieName,
+		Value:    "",
+		Path:     "/api/token",
+		Expires:  time.Now().Add(-time.Hour),
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: "None",
+	})
+}
@@ -0,0 +1,361 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/search"
+	"github.com/raihan1405/go-restapi/validators"
+	"gorm.io/gorm"
+)
+
+// BrandResponse is a brand with the number of products in the catalogue
+type BrandResponse struct {
+	models.Brand
+	ProductCount int64 `json:"productCount"`
+}
+
+// BrandListResponse is one page of brands
+type BrandListResponse struct {
+	Brands []BrandResponse `json:"brands"`
+	Page   int             `json:"page"`
+	Limit  int             `json:"limit"`
+	Total  int64           `json:"total"`
+}
+
+var errUnknownBrand = errors.New("brand does not exist")
+
+// brandsWithCounts selects brands together with their number of products that are not deleted
+func brandsWithCounts() *gorm.DB {
+	return db.DB.Model(&models.Brand{}).
+		Select("brands.*, COUNT(products.id) AS product_count").
+		Joins("LEFT JOIN products ON products.brand_id = brands.id AND products.deleted_at IS NULL").
+		Group("brands.id")
+}
+
+// resolveProductBrand finds the brand a product is saved with, by ID or else
+// by the slug of the given name
+func resolveProductBrand(id int, name string) (models.Brand, error) {
+	var brand models.Brand
+	query := db.DB.Where("id = ?", id)
+	if id == 0 {
+		query = db.DB.Where("slug = ?", models.Slugify(name))
+	}
+
+	err := query.First(&brand).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return brand, errUnknownBrand
+	}
+	return brand, err
+}
+
+// canManageBrand reports whether the principal may change the brand: its
+// owner, or anyone who may change every product
+func canManageBrand(principal *auth.Principal, brand models.Brand) bool {
+	if principal.Can(auth.PermProductWriteAny) {
+		return true
+	}
+	return brand.OwnerID != nil && *brand.OwnerID == principal.UserID
+}
+
+// canUseBrand reports whether the principal may sell products under the
+// brand: brands without an owner are open to every seller, owned brands only
+// to their owner and to anyone who may change every product
+func canUseBrand(principal *auth.Principal, brand models.Brand) bool {
+	return brand.OwnerID == nil || canManageBrand(principal, brand)
+}
+
+// brandTarget is a brand as the target of an audited action
+func brandTarget(id int) audit.Target {
+	return audit.Target{Type: "brand", ID: strconv.Itoa(id)}
+}
+
+// GetBrands godoc
+// @Summary List brands
+// @Description List brands by name with the number of products each has in the catalogue
+// @Tags brand
+// @Produce json
+// @Param q query string false "Part of the brand name"
+// @Param page query int false "Page number, from 1" default(1)
+// @Param limit query int false "Brands per page, at most 100" default(20)
+// @Success 200 {object} BrandListResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/brands [get]
+func GetBrands(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := func(query *gorm.DB) *gorm.DB {
+		if q := strings.TrimSpace(c.Query("q")); q != "" {
+			query = query.Where("brands.name LIKE ?", "%"+likeEscaper.Replace(q)+"%")
+		}
+		return query
+	}
+
+	response := BrandListResponse{Brands: []BrandResponse{}, Page: page, Limit: limit}
+	if err := filter(db.DB.Model(&models.Brand{})).Count(&response.Total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve brands", err.Error()})
+	}
+
+	err := filter(brandsWithCounts()).Order("brands.name").Order("brands.id").
+		Offset((page - 1) * limit).Limit(limit).Scan(&response.Brands).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve brands", err.Error()})
+	}
+
+	return c.JSON(response)
+}
+
+// GetBrand godoc
+// @Summary Get a brand page
+// @Description Get a brand by ID or slug, with its number of products. The products themselves are listed by GET /api/products?brand_id=.
+// @Tags brand
+// @Produce json
+// @Param id path string true "Brand ID or slug"
+// @Success 200 {object} BrandResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/brands/{id} [get]
+func GetBrand(c *fiber.Ctx) error {
+	query := brandsWithCounts()
+	if id, err := strconv.Atoi(c.Params("id")); err == nil {
+		query = query.Where("brands.id = ?", id)
+	} else {
+		query = query.Where("brands.slug = ?", c.Params("id"))
+	}
+
+	var brands []BrandResponse
+	if err := query.Limit(1).Scan(&brands).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve brand", err.Error()})
+	}
+	if len(brands) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"Brand not found", "No brand with the given ID or slug"})
+	}
+
+	return c.JSON(brands[0])
+}
+
+// parseBrandInput reads and checks the body of a create or update request.
+// When the input is not acceptable it writes the error response and reports false.
+func parseBrandInput(c *fiber.Ctx, brand *models.Brand) (bool, error) {
+	var data validators.BrandInput
+	if err := c.BodyParser(&data); err != nil {
+		return false, c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+	if err := validators.Validate.Struct(data); err != nil {
+		return false, c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	slug := data.Slug
+	if slug == "" {
+		slug = data.Name
+	}
+	brand.Name = data.Name
+	brand.Slug = models.Slugify(slug)
+	brand.LogoURL = data.LogoURL
+	brand.Description = data.Description
+	if brand.Slug == "" {
+		return false, c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", "The slug needs at least one letter or digit"})
+	}
+
+	return true, nil
+}
+
+// CreateBrand godoc
+// @Summary Create a brand
+// @Description Create a brand page. The seller who creates it manages it. The slug defaults to the name.
+// @Tags brand
+// @Accept json
+// @Produce json
+// @Param brand body validators.BrandInput true "Brand details"
+// @Success 201 {object} models.Brand
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ConflictResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/brands [post]
+func CreateBrand(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	brand := models.Brand{OwnerID: &principal.UserID}
+	if ok, resp := parseBrandInput(c, &brand); !ok {
+		return resp
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&brand).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "brand.create",
+			Target: brandTarget(brand.ID),
+			After:  brand,
+		})
+	})
+	if err != nil {
+		if ok, resp := conflict(c, err); ok {
+			return resp
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot create brand", err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(brand)
+}
+
+// UpdateBrand godoc
+// @Summary Update a brand
+// @Description Update a brand page. Sellers can only update their own brands, admins any brand. Products of the brand take over a new name.
+// @Tags brand
+// @Accept json
+// @Produce json
+// @Param id path int true "Brand ID"
+// @Param brand body validators.BrandInput true "Brand details"
+// @Success 200 {object} models.Brand
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ConflictResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/brands/{id} [put]
+func UpdateBrand(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid brand ID", err.Error()})
+	}
+
+	var brand models.Brand
+	if err := db.DB.First(&brand, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"Brand not found", "No brand with the given ID"})
+	}
+	if !canManageBrand(principal, brand) {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{"forbidden", "You can only update your own brands"})
+	}
+
+	before := brand
+	if ok, resp := parseBrandInput(c, &brand); !ok {
+		return resp
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&brand).Error; err != nil {
+			return err
+		}
+
+		// Products keep the brand name next to its ID
+		if brand.Name != before.Name {
+			err := tx.Model(&models.Product{}).Unscoped().Where("brand_id = ?", id).Update("brand_name", brand.Name).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "brand.update",
+			Target: brandTarget(id),
+			Before: before,
+			After:  brand,
+		})
+	})
+	if err != nil {
+		if ok, resp := conflict(c, err); ok {
+			return resp
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot update brand", err.Error()})
+	}
+
+	if brand.Name != before.Name {
+		var products []models.Product
+		if err := db.DB.Where("brand_id = ?", id).Find(&products).Error; err == nil {
+			for _, product := range products {
+				search.IndexProduct(product)
+			}
+		}
+	}
+
+	return c.JSON(brand)
+}
+
+// DeleteBrand godoc
+// @Summary Delete a brand
+// @Description Delete a brand that has no products, including deleted products. Sellers can only delete their own brands, admins any brand.
+// @Tags brand
+// @Produce json
+// @Param id path int true "Brand ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/brands/{id} [delete]
+func DeleteBrand(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid brand ID", err.Error()})
+	}
+
+	var brand models.Brand
+	if err := db.DB.First(&brand, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"Brand not found", "No brand with the given ID"})
+	}
+	if !canManageBrand(principal, brand) {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{"forbidden", "You can only delete your own brands"})
+	}
+
+	var products int64
+	if err := db.DB.Model(&models.Product{}).Unscoped().Where("brand_id = ?", id).Count(&products).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot delete brand", err.Error()})
+	}
+	if products > 0 {
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{"Brand in use", "Move its products to another brand first"})
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&brand).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "brand.delete",
+			Target: brandTarget(id),
+			Before: brand,
+		})
+	})
+	if db.RowReferenced(err) {
+		// A product was added after the check above
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{"Brand in use", "Move its products to another brand first"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot delete brand", err.Error()})
+	}
+
+	return c.JSON(SuccessResponse{Message: "Brand deleted"})
+}
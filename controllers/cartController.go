@@ -4,10 +4,13 @@ import (
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4" // Menggunakan jwt dari golang-jwt/jwt/v4
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
 	"github.com/raihan1405/go-restapi/db"
 	"github.com/raihan1405/go-restapi/models"
 	"github.com/raihan1405/go-restapi/validators"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // SuccessResponse digunakan untuk mengembalikan pesan sukses
@@ -15,59 +18,100 @@ type SuccessResponse struct {
 	Message string `json:"message"`
 }
 
+// CartLineResponse is a cart item together with the product it refers to.
+// Lines whose product has been deleted are flagged as unavailable and do
+// not count towards the totals.
+type CartLineResponse struct {
+	ID          int            `json:"id"`
+	ProductID   int            `json:"productId"`
+	Quantity    int            `json:"quantity"`
+	Product     models.Product `json:"product"`
+	Subtotal    int            `json:"subtotal"`
+	Unavailable bool           `json:"unavailable"`
+}
+
+// CartResponse is the full content of the user's cart
+type CartResponse struct {
+	Items         []CartLineResponse `json:"items"`
+	TotalQuantity int                `json:"totalQuantity"`
+	Total         int                `json:"total"`
+}
+
+// withDeletedProducts lets cart lines load products that have been deleted
+// from the catalogue, so those lines can be shown as unavailable
+func withDeletedProducts(tx *gorm.DB) *gorm.DB {
+	return tx.Unscoped()
+}
+
 // AddToCart godoc
 // @Summary Add a product to cart
-// @Description Add a product to the user's cart
+// @Description Add a product to the user's cart. Adding a product that is already in the cart increases its quantity. With EMAIL_VERIFICATION_POLICY=checkout the email has to be verified first.
 // @Tags cart
 // @Accept json
 // @Produce json
 // @Param cart body validators.AddToCartInput true "Cart item details"
 // @Success 200 {object} models.CartItem
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/cart [post]
 func AddToCart(c *fiber.Ctx) error {
-	user, ok := c.Locals("user").(*jwt.Token)
-	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Unauthorized"})
-	}
-
-	claims, ok := user.Claims.(jwt.MapClaims)
+	principal, ok := auth.GetPrincipal(c)
 	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Invalid token claims"})
-	}
-
-	userID, ok := claims["sub"].(string)
-	if !ok || userID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Invalid user ID in token"})
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Message: "unauthenticated", Error: "Invalid or expired token"})
 	}
+	userID := principal.UserID
 
 	var data validators.AddToCartInput
 
 	if err := c.BodyParser(&data); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Message: "Cannot parse JSON", Error: err.Error()})
 	}
 
 	if err := validators.Validate.Struct(data); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Message: "Validation error", Error: err.Error()})
 	}
 
 	// Find the product
 	var product models.Product
 	if err := db.DB.First(&product, data.ProductID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Product not found"})
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Message: "Product not found", Error: err.Error()})
 	}
 
-	// Create cart item
+	// Insert the line, or add to the quantity of the existing (user, product) line
 	cartItem := models.CartItem{
 		ProductID: data.ProductID,
 		UserID:    userID,
 		Quantity:  data.Quantity,
 	}
-
-	// Save cart item to database
-	if err := db.DB.Create(&cartItem).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Cannot add product to cart"})
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "product_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"quantity": gorm.Expr("quantity + ?", data.Quantity)}),
+		}).Create(&cartItem).Error
+		if err != nil {
+			return err
+		}
+
+		// Reload the line so the merged quantity is returned
+		err = tx.Preload("Product").
+			Where("user_id = ? AND product_id = ?", userID, data.ProductID).
+			First(&cartItem).Error
+		if err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action:  "cart.add",
+			Target:  cartItemTarget(cartItem.ID),
+			After:   cartItemState(cartItem),
+			Details: fiber.Map{"added": data.Quantity},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Message: "Cannot add product to cart", Error: err.Error()})
 	}
 
 	return c.JSON(cartItem)
@@ -75,36 +119,46 @@ func AddToCart(c *fiber.Ctx) error {
 
 // GetCart godoc
 // @Summary Get all items in the cart
-// @Description Get a list of all items in the user's cart
+// @Description Get all items in the user's cart with product details, line subtotals and the cart total. Lines whose product has been deleted are flagged as unavailable and left out of the totals.
 // @Tags cart
 // @Produce json
-// @Success 200 {array} models.CartItem
+// @Success 200 {object} CartResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/cart [get]
 func GetCart(c *fiber.Ctx) error {
-	user, ok := c.Locals("user").(*jwt.Token)
+	principal, ok := auth.GetPrincipal(c)
 	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Unauthorized"})
-	}
-
-	claims, ok := user.Claims.(jwt.MapClaims)
-	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Invalid token claims"})
-	}
-
-	userID, ok := claims["sub"].(string)
-	if !ok || userID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Invalid user ID in token"})
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Message: "unauthenticated", Error: "Invalid or expired token"})
 	}
+	userID := principal.UserID
 
 	var cartItems []models.CartItem
 
 	// Retrieve all cart items for the user from the database
-	if err := db.DB.Where("user_id = ?", userID).Find(&cartItems).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Cannot retrieve cart items"})
+	if err := db.DB.Preload("Product", withDeletedProducts).Where("user_id = ?", userID).Order("id").Find(&cartItems).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Message: "Cannot retrieve cart items", Error: err.Error()})
 	}
 
-	return c.JSON(cartItems)
+	cart := CartResponse{Items: make([]CartLineResponse, 0, len(cartItems))}
+	for _, item := range cartItems {
+		line := CartLineResponse{
+			ID:          item.ID,
+			ProductID:   item.ProductID,
+			Quantity:    item.Quantity,
+			Product:     item.Product,
+			Unavailable: item.Product.DeletedAt.Valid,
+		}
+		if !line.Unavailable {
+			line.Subtotal = item.Product.Price * item.Quantity
+			cart.TotalQuantity += item.Quantity
+			cart.Total += line.Subtotal
+		}
+		cart.Items = append(cart.Items, line)
+	}
+
+	return c.JSON(cart)
 }
 
 // RemoveFromCart godoc
@@ -114,38 +168,42 @@ func GetCart(c *fiber.Ctx) error {
 // @Param id path int true "Cart Item ID"
 // @Success 200 {object} SuccessResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/cart/{id} [delete]
 func RemoveFromCart(c *fiber.Ctx) error {
-	user, ok := c.Locals("user").(*jwt.Token)
-	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Unauthorized"})
-	}
-
-	claims, ok := user.Claims.(jwt.MapClaims)
+	principal, ok := auth.GetPrincipal(c)
 	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Invalid token claims"})
-	}
-
-	userID, ok := claims["sub"].(string)
-	if !ok || userID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Invalid user ID in token"})
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Message: "unauthenticated", Error: "Invalid or expired token"})
 	}
+	userID := principal.UserID
 
 	id, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid cart item ID"})
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Message: "Invalid cart item ID", Error: err.Error()})
 	}
 
 	var cartItem models.CartItem
 	if err := db.DB.Where("id = ? AND user_id = ?", id, userID).First(&cartItem).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Cart item not found"})
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Message: "Cart item not found", Error: err.Error()})
 	}
 
 	// Delete the cart item
-	if err := db.DB.Delete(&cartItem).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Cannot remove cart item"})
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&cartItem).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "cart.remove",
+			Target: cartItemTarget(cartItem.ID),
+			Before: cartItemState(cartItem),
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Message: "Cannot remove cart item", Error: err.Error()})
 	}
 
 	return c.JSON(SuccessResponse{Message: "Item removed from cart"})
@@ -153,7 +211,7 @@ func RemoveFromCart(c *fiber.Ctx) error {
 
 // UpdateCartItem godoc
 // @Summary Update an item in the cart
-// @Description Update the quantity of an item in the user's cart
+// @Description Update the quantity of an item in the user's cart. Lines whose product has been deleted can only be removed. With EMAIL_VERIFICATION_POLICY=checkout the email has to be verified first.
 // @Tags cart
 // @Accept json
 // @Produce json
@@ -161,49 +219,58 @@ func RemoveFromCart(c *fiber.Ctx) error {
 // @Param cart body validators.UpdateCartItemInput true "Updated cart item details"
 // @Success 200 {object} models.CartItem
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/cart/{id} [put]
 func UpdateCartItem(c *fiber.Ctx) error {
-	user, ok := c.Locals("user").(*jwt.Token)
-	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Unauthorized"})
-	}
-
-	claims, ok := user.Claims.(jwt.MapClaims)
+	principal, ok := auth.GetPrincipal(c)
 	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Invalid token claims"})
-	}
-
-	userID, ok := claims["sub"].(string)
-	if !ok || userID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Error: "Invalid user ID in token"})
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{Message: "unauthenticated", Error: "Invalid or expired token"})
 	}
+	userID := principal.UserID
 
 	id, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Invalid cart item ID"})
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Message: "Invalid cart item ID", Error: err.Error()})
 	}
 
 	var data validators.UpdateCartItemInput
 	if err := c.BodyParser(&data); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: "Cannot parse JSON"})
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Message: "Cannot parse JSON", Error: err.Error()})
 	}
 
 	if err := validators.Validate.Struct(data); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Error: err.Error()})
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{Message: "Validation error", Error: err.Error()})
 	}
 
 	var cartItem models.CartItem
-	if err := db.DB.Where("id = ? AND user_id = ?", id, userID).First(&cartItem).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Error: "Cart item not found"})
+	if err := db.DB.Preload("Product", withDeletedProducts).Where("id = ? AND user_id = ?", id, userID).First(&cartItem).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{Message: "Cart item not found", Error: err.Error()})
 	}
 
-	// Update the cart item quantity
-	cartItem.Quantity = data.Quantity
+	if cartItem.Product.DeletedAt.Valid {
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{Message: "Product unavailable", Error: "The product has been removed from the catalogue"})
+	}
 
-	if err := db.DB.Save(&cartItem).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Error: "Cannot update cart item"})
+	// Update the cart item quantity
+	before := cartItemState(cartItem)
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&cartItem).Update("quantity", data.Quantity).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "cart.update",
+			Target: cartItemTarget(cartItem.ID),
+			Before: before,
+			After:  cartItemState(cartItem),
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{Message: "Cannot update cart item", Error: err.Error()})
 	}
 
 	return c.JSON(cartItem)
@@ -0,0 +1,398 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/search"
+	"github.com/raihan1405/go-restapi/validators"
+	"gorm.io/gorm"
+)
+
+// CategoryNode is a category with its subcategories
+type CategoryNode struct {
+	models.Category
+	Children []CategoryNode `json:"children"`
+}
+
+var errUnknownCategory = errors.New("category does not exist")
+
+// loadCategories returns every category in display order
+func loadCategories(tx *gorm.DB) ([]models.Category, error) {
+	var categories []models.Category
+	err := tx.Order("position").Order("name").Order("id").Find(&categories).Error
+	return categories, err
+}
+
+// categoryTree arranges categories under their parents, starting from the
+// categories whose parent is root (nil for the top level)
+func categoryTree(categories []models.Category, root *int) []CategoryNode {
+	children := map[int][]models.Category{}
+	var top []models.Category
+	for _, category := range categories {
+		if category.ParentID == nil {
+			top = append(top, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	var build func([]models.Category) []CategoryNode
+	build = func(level []models.Category) []CategoryNode {
+		nodes := make([]CategoryNode, 0, len(level))
+		for _, category := range level {
+			nodes = append(nodes, CategoryNode{Category: category, Children: build(children[category.ID])})
+		}
+		return nodes
+	}
+
+	if root == nil {
+		return build(top)
+	}
+	return build(children[*root])
+}
+
+// categoryDescendants returns the ID of the category and of every category below it
+func categoryDescendants(id int) ([]int, error) {
+	categories, err := loadCategories(db.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int{}
+	for _, category := range categorySubtree(categories, id) {
+		ids = append(ids, category.ID)
+	}
+	return ids, nil
+}
+
+// categorySubtreeByName returns the category with the name or slug and every
+// category below it, or none if there is no such category
+func categorySubtreeByName(name string) ([]models.Category, error) {
+	categories, err := loadCategories(db.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	slug := models.Slugify(name)
+	for _, category := range categories {
+		if category.Slug == slug {
+			return categorySubtree(categories, category.ID), nil
+		}
+	}
+	return nil, nil
+}
+
+// categorySubtree picks the category with the ID and its descendants out of
+// all categories
+func categorySubtree(categories []models.Category, id int) []models.Category {
+	byID := map[int]models.Category{}
+	children := map[int][]int{}
+	for _, category := range categories {
+		byID[category.ID] = category
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.ID)
+		}
+	}
+
+	var subtree []models.Category
+	ids := []int{id}
+	for i := 0; i < len(ids); i++ {
+		if category, ok := byID[ids[i]]; ok {
+			subtree = append(subtree, category)
+		}
+		ids = append(ids, children[ids[i]]...)
+	}
+	return subtree
+}
+
+// resolveProductCategory finds the category a product is saved with, by ID
+// or else by the slug of the given name
+func resolveProductCategory(id int, name string) (models.Category, error) {
+	var category models.Category
+	query := db.DB.Where("id = ?", id)
+	if id == 0 {
+		query = db.DB.Where("slug = ?", models.Slugify(name))
+	}
+
+	err := query.First(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return category, errUnknownCategory
+	}
+	return category, err
+}
+
+// categoryTarget is a category as the target of an audited action
+func categoryTarget(id int) audit.Target {
+	return audit.Target{Type: "category", ID: strconv.Itoa(id)}
+}
+
+// GetCategoryTree godoc
+// @Summary Get the category tree
+// @Description Get every category, nested under its parent and in display order
+// @Tags category
+// @Produce json
+// @Success 200 {array} CategoryNode
+// @Failure 500 {object} ErrorResponse
+// @Router /api/categories [get]
+func GetCategoryTree(c *fiber.Ctx) error {
+	categories, err := loadCategories(db.DB)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve categories", err.Error()})
+	}
+
+	return c.JSON(categoryTree(categories, nil))
+}
+
+// GetCategory godoc
+// @Summary Get a category
+// @Description Get a category with its subcategories
+// @Tags category
+// @Produce json
+// @Param id path int true "Category ID"
+// @Success 200 {object} CategoryNode
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/categories/{id} [get]
+func GetCategory(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid category ID", err.Error()})
+	}
+
+	categories, err := loadCategories(db.DB)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve categories", err.Error()})
+	}
+
+	for _, category := range categories {
+		if category.ID == id {
+			return c.JSON(CategoryNode{Category: category, Children: categoryTree(categories, &id)})
+		}
+	}
+	return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"Category not found", "No category with the given ID"})
+}
+
+// parseCategoryInput reads and checks the body of a create or update request
+// for the category with the given ID (0 when creating). When the input is
+// not acceptable it writes the error response and reports false.
+func parseCategoryInput(c *fiber.Ctx, id int) (models.Category, bool, error) {
+	var data validators.CategoryInput
+	if err := c.BodyParser(&data); err != nil {
+		return models.Category{}, false, c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+	if err := validators.Validate.Struct(data); err != nil {
+		return models.Category{}, false, c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	slug := data.Slug
+	if slug == "" {
+		slug = data.Name
+	}
+	category := models.Category{
+		ID:       id,
+		Name:     data.Name,
+		Slug:     models.Slugify(slug),
+		ParentID: data.ParentID,
+		Position: data.Position,
+	}
+	if category.Slug == "" {
+		return category, false, c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", "The slug needs at least one letter or digit"})
+	}
+
+	// The parent has to exist and, when moving a category, must not be inside it
+	if category.ParentID != nil {
+		parents := map[int]*int{}
+		categories, err := loadCategories(db.DB)
+		if err != nil {
+			return category, false, c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve categories", err.Error()})
+		}
+		for _, existing := range categories {
+			parents[existing.ID] = existing.ParentID
+		}
+
+		if _, ok := parents[*category.ParentID]; !ok {
+			return category, false, c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid parent", "The parent category does not exist"})
+		}
+		for ancestor, depth := category.ParentID, 0; ancestor != nil && depth <= len(parents); ancestor, depth = parents[*ancestor], depth+1 {
+			if *ancestor == id {
+				return category, false, c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid parent", "A category cannot be moved below itself"})
+			}
+		}
+	}
+
+	return category, true, nil
+}
+
+// CreateCategory godoc
+// @Summary Create a category
+// @Description Create a category, at the top level or below a parent. The slug defaults to the name.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param category body validators.CategoryInput true "Category details"
+// @Success 201 {object} models.Category
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ConflictResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/categories [post]
+func CreateCategory(c *fiber.Ctx) error {
+	category, ok, resp := parseCategoryInput(c, 0)
+	if !ok {
+		return resp
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&category).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "category.create",
+			Target: categoryTarget(category.ID),
+			After:  category,
+		})
+	})
+	if err != nil {
+		if ok, resp := conflict(c, err); ok {
+			return resp
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot create category", err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(category)
+}
+
+// UpdateCategory godoc
+// @Summary Update a category
+// @Description Rename, move or reorder a category. Products in the category take over a new name.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Category ID"
+// @Param category body validators.CategoryInput true "Category details"
+// @Success 200 {object} models.Category
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ConflictResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/categories/{id} [put]
+func UpdateCategory(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid category ID", err.Error()})
+	}
+
+	var before models.Category
+	if err := db.DB.First(&before, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"Category not found", "No category with the given ID"})
+	}
+
+	category, ok, resp := parseCategoryInput(c, id)
+	if !ok {
+		return resp
+	}
+	category.CreatedAt = before.CreatedAt
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&category).Error; err != nil {
+			return err
+		}
+
+		// Products keep the category name next to its ID
+		if category.Name != before.Name {
+			err := tx.Model(&models.Product{}).Unscoped().Where("category_id = ?", id).Update("category", category.Name).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "category.update",
+			Target: categoryTarget(id),
+			Before: before,
+			After:  category,
+		})
+	})
+	if err != nil {
+		if ok, resp := conflict(c, err); ok {
+			return resp
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot update category", err.Error()})
+	}
+
+	if category.Name != before.Name {
+		var products []models.Product
+		if err := db.DB.Where("category_id = ?", id).Find(&products).Error; err == nil {
+			for _, product := range products {
+				search.IndexProduct(product)
+			}
+		}
+	}
+
+	return c.JSON(category)
+}
+
+// DeleteCategory godoc
+// @Summary Delete a category
+// @Description Delete a category that has no subcategories and no products, including deleted products
+// @Tags admin
+// @Produce json
+// @Param id path int true "Category ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/categories/{id} [delete]
+func DeleteCategory(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid category ID", err.Error()})
+	}
+
+	var category models.Category
+	if err := db.DB.First(&category, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"Category not found", "No category with the given ID"})
+	}
+
+	var children, products int64
+	err = db.DB.Model(&models.Category{}).Where("parent_id = ?", id).Count(&children).Error
+	if err == nil {
+		err = db.DB.Model(&models.Product{}).Unscoped().Where("category_id = ?", id).Count(&products).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot delete category", err.Error()})
+	}
+	if children > 0 || products > 0 {
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{"Category in use", "Move its subcategories and products to another category first"})
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&category).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "category.delete",
+			Target: categoryTarget(id),
+			Before: category,
+		})
+	})
+	if db.RowReferenced(err) {
+		// A product or subcategory was added after the check above
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{"Category in use", "Move its subcategories and products to another category first"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot delete category", err.Error()})
+	}
+
+	return c.JSON(SuccessResponse{Message: "Category deleted"})
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/db"
+)
+
+// ConflictResponse is returned with 409 when a value must be unique and is
+// already taken. Field names the offending input field.
+type ConflictResponse struct {
+	Message string `json:"message"`
+	Error   string `json:"error"`
+	Field   string `json:"field"`
+}
+
+// uniqueField is the input field a unique index protects and the error shown
+// when a value is taken
+type uniqueField struct {
+	field string
+	error string
+}
+
+// uniqueFields maps unique indexes to the input field they protect
+var uniqueFields = map[string]uniqueField{
+	"idx_users_email":     {"email", "This email is already used by another account"},
+	"idx_users_username":  {"username", "This username is already used by another account"},
+	"idx_categories_slug": {"slug", "This slug is already used by another category"},
+	"idx_brands_slug":     {"slug", "This slug is already used by another brand"},
+}
+
+// conflict writes a 409 response if err is a violation of a known unique
+// index. It reports whether it did.
+func conflict(c *fiber.Ctx, err error) (bool, error) {
+	index, ok := db.DuplicateKey(err)
+	if !ok {
+		return false, nil
+	}
+
+	unique, ok := uniqueFields[index]
+	if !ok {
+		return false, nil
+	}
+
+	return true, c.Status(fiber.StatusConflict).JSON(ConflictResponse{
+		Message: "Already in use",
+		Error:   unique.error,
+		Field:   unique.field,
+	})
+}
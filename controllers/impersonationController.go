@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/dto"
+	"github.com/raihan1405/go-restapi/models"
+	"gorm.io/gorm"
+)
+
+// ImpersonationResponse is returned when an admin starts acting as a user
+type ImpersonationResponse struct {
+	Message      string    `json:"message"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refreshToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	User         dto.User  `json:"user"`
+}
+
+// ImpersonateUser godoc
+// @Summary Log in as a user
+// @Description Open a time-boxed session in which the admin acts as the user, to see what they see. The token cookies are replaced by those of the new session; logging out ends it. Changing credentials, the profile or deleting the account is not possible in the session. Admins cannot be impersonated.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} ImpersonationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/users/{id}/impersonate [post]
+func ImpersonateUser(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid user ID", err.Error()})
+	}
+
+	if userID == principal.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot impersonate user", "Admins cannot impersonate themselves"})
+	}
+
+	var user models.User
+	if err := db.DB.Preload("Roles").First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	// Menyamar sebagai admin lain akan melewati batas hak akses
+	for _, role := range user.RoleNames() {
+		if role == models.RoleAdmin {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{"Cannot impersonate user", "Admins cannot be impersonated"})
+		}
+	}
+	if user.IsDisabled() {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{"Cannot impersonate user", "The account has been disabled"})
+	}
+
+	var pair *auth.TokenPair
+	err = db.DB.Transaction(func(tx *gorm.DB) (err error) {
+		pair, err = auth.StartImpersonation(tx, principal.UserID, user.ID, c.Get(fiber.HeaderUserAgent), c.IP())
+		if err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action:  "user.impersonate",
+			Target:  userTarget(user.ID),
+			Details: fiber.Map{"sessionId": pair.SessionID, "expiresAt": pair.RefreshExpiresAt},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot impersonate user", err.Error()})
+	}
+
+	setSessionCookies(c, pair)
+
+	return c.JSON(ImpersonationResponse{
+		Message:      "Impersonation started",
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresAt:    pair.RefreshExpiresAt,
+		User:         dto.NewUser(user),
+	})
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/validators"
+)
+
+// GetJWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys that verify access tokens, including retired keys still in their grace window
+// @Tags auth
+// @Produce json
+// @Success 200 {object} auth.JWKSet
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(auth.Keys.JWKS())
+}
+
+// GetSigningKeys godoc
+// @Summary List signing keys
+// @Description List the access token signing keys that have not expired, newest first
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.SigningKey
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/keys [get]
+func GetSigningKeys(c *fiber.Ctx) error {
+	var keys []models.SigningKey
+	err := db.DB.Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC").
+		Find(&keys).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve signing keys", err.Error()})
+	}
+
+	return c.JSON(keys)
+}
+
+// RotateSigningKey godoc
+// @Summary Rotate the signing key
+// @Description Create a new signing key and retire the current one. Tokens signed with the retired key stay valid for the grace window (JWT_KEY_GRACE).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param key body validators.RotateKeyInput false "Algorithm of the new key, defaults to the current one"
+// @Success 201 {object} models.SigningKey
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/keys/rotate [post]
+func RotateSigningKey(c *fiber.Ctx) error {
+	var data validators.RotateKeyInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&data); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+		}
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	algorithm := data.Algorithm
+	if algorithm == "" {
+		algorithm = auth.Keys.Algorithm()
+	}
+
+	key, err := auth.Keys.Rotate(auditActor(c), algorithm)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot rotate signing key", err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(key)
+}
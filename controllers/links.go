@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"net/url"
+	"os"
+	"strings"
+)
+
+// frontendURL builds a link to a page of the frontend app at APP_URL
+// (default http://localhost:5173), used in emails sent to users
+func frontendURL(path string, query url.Values) string {
+	base := os.Getenv("APP_URL")
+	if base == "" {
+		base = "http://localhost:5173"
+	}
+
+	link := strings.TrimRight(base, "/") + path
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/lockout"
+	"github.com/raihan1405/go-restapi/mailer"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/validators"
+	"gorm.io/gorm"
+)
+
+// magicLinkTTL is how long a magic login link stays valid
+const magicLinkTTL = 10 * time.Minute
+
+// RequestMagicLink godoc
+// @Summary Request a magic login link
+// @Description Email a single-use link that logs the user in without a password. The response is the same whether or not the email belongs to an account. Requests are rate limited per email and per IP.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param magicLink body validators.MagicLinkInput true "Account email"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/login/magic-link [post]
+func RequestMagicLink(c *fiber.Ctx) error {
+	var data validators.MagicLinkInput
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	// Setiap permintaan dihitung, terdaftar atau tidak, agar inbox tidak bisa dibanjiri
+	emailKey := validators.NormalizeEmail(data.Email)
+	wait, err := magicLinkLimited(emailKey, c.IP())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot send magic link", err.Error()})
+	}
+	if wait > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return c.Status(fiber.StatusTooManyRequests).JSON(ErrorResponse{"Too many requests", "Try again in " + wait.Round(time.Second).String()})
+	}
+
+	// Send in the background so the response time does not reveal whether the email is registered
+	go sendMagicLink(emailKey)
+
+	return c.JSON(SuccessResponse{Message: "If an account exists for this email, a login link has been sent"})
+}
+
+// magicLinkLimited counts a magic-link request for the email and IP and
+// returns how long the caller has to wait if either is over its limit
+func magicLinkLimited(emailKey, ip string) (time.Duration, error) {
+	for _, check := range []struct {
+		limiter *lockout.Limiter
+		key     string
+	}{
+		{lockout.MagicLinkIPs, ip},
+		{lockout.MagicLinks, emailKey},
+	} {
+		wait, err := check.limiter.Check(check.key)
+		if err != nil || wait > 0 {
+			return wait, err
+		}
+	}
+
+	if err := lockout.MagicLinkIPs.Fail(ip); err != nil {
+		return 0, err
+	}
+	return 0, lockout.MagicLinks.Fail(emailKey)
+}
+
+// sendMagicLink issues a login token for the account with the email, if any, and mails it
+func sendMagicLink(email string) {
+	var user models.User
+	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		return
+	}
+
+	token, err := auth.IssueOneTimeToken(user.ID, models.TokenPurposeMagicLink, magicLinkTTL)
+	if err != nil {
+		log.Printf("cannot issue magic link token for user %d: %v", user.ID, err)
+		return
+	}
+
+	link := frontendURL("/login/magic-link", url.Values{"token": {token}})
+	err = mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to log in. It expires in %s and can only be used once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.Username, magicLinkTTL, link),
+	})
+	if err != nil {
+		log.Printf("cannot send magic link email to user %d: %v", user.ID, err)
+	}
+}
+
+// MagicLinkCallback godoc
+// @Summary Log in with a magic link
+// @Description Exchange the token from a magic login link for a session, setting the same cookies as Login. The token can only be used once. Following the link also confirms the email address. Users with two-factor authentication get an MFA challenge token instead, to be completed at /api/login/mfa.
+// @Tags auth
+// @Produce json
+// @Param token query string true "Magic link token"
+// @Success 200 {object} LoginResponse
+// @Success 202 {object} MFAChallengeResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/login/magic-link/callback [get]
+func MagicLinkCallback(c *fiber.Ctx) error {
+	raw := c.Query("token")
+	if raw == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Missing token", "The token query parameter is required"})
+	}
+
+	var user models.User
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := auth.ConsumeOneTimeToken(tx, raw, models.TokenPurposeMagicLink)
+		if err != nil {
+			return err
+		}
+
+		// The link was delivered to the inbox, which proves the address
+		err = tx.Model(&models.User{}).
+			Where("id = ? AND verified_at IS NULL", token.UserID).
+			Update("verified_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.First(&user, token.UserID).Error
+	})
+	if errors.Is(err, auth.ErrInvalidOneTimeToken) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid login link", err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", err.Error()})
+	}
+
+	return completeLogin(c, user)
+}
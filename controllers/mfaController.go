@@ -0,0 +1,402 @@
+package controllers
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/lockout"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/validators"
+	"gorm.io/gorm"
+)
+
+const (
+	// mfaChallengeTTL is how long the user has to enter a code after the password step
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaChallengeAttempts is how many wrong codes a challenge accepts before it is burnt
+	mfaChallengeAttempts = 5
+	// recoveryCodeCount is how many recovery codes are issued at a time
+	recoveryCodeCount = 10
+)
+
+// MFAChallengeResponse dikembalikan oleh Login jika pengguna memakai 2FA
+type MFAChallengeResponse struct {
+	Message        string `json:"message"`
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challengeToken"`
+}
+
+// MFAEnrollResponse contains the secret to add to an authenticator app
+type MFAEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+}
+
+// RecoveryCodesResponse contains freshly issued recovery codes. They are only shown once.
+type RecoveryCodesResponse struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// LoginMFA godoc
+// @Summary Complete a login with a second factor
+// @Description Exchange the challenge token returned by Login and a TOTP or recovery code for a session
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param mfa body validators.LoginMFAInput true "Challenge token and code"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/login/mfa [post]
+func LoginMFA(c *fiber.Ctx) error {
+	var data validators.LoginMFAInput
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	challenge, err := auth.FindOneTimeToken(data.ChallengeToken, models.TokenPurposeMFAChallenge)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Invalid challenge", err.Error()})
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, challenge.UserID).Error; err != nil || !user.MFAEnabled() {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Invalid challenge", "Two-factor authentication is not enabled"})
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords, so
+	// fresh challenges do not give an attacker fresh attempts
+	accountKey := validators.NormalizeEmail(user.Email)
+	if locked, err := loginLockedFor(accountKey, c.IP()); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", err.Error()})
+	} else if locked > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(locked.Seconds()))))
+		return c.Status(fiber.StatusTooManyRequests).JSON(ErrorResponse{"Too many failed attempts", "Try again in " + locked.Round(time.Second).String()})
+	}
+
+	if !checkSecondFactor(&user, data.Code, data.RecoveryCode) {
+		if err := recordLoginFailure(accountKey, c.IP()); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", err.Error()})
+		}
+		if err := auth.RecordFailedAttempt(challenge, mfaChallengeAttempts); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", err.Error()})
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Invalid code", "The code is incorrect or has already been used"})
+	}
+
+	// The challenge is single-use
+	if _, err := auth.ConsumeOneTimeToken(db.DB, data.ChallengeToken, models.TokenPurposeMFAChallenge); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Invalid challenge", err.Error()})
+	}
+
+	if err := lockout.Accounts.Reset(accountKey); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", err.Error()})
+	}
+
+	return loginSuccess(c, user)
+}
+
+// EnrollMFA godoc
+// @Summary Start TOTP enrolment
+// @Description Generate a TOTP secret for the authenticated user. Two-factor authentication is enabled once the first code is confirmed.
+// @Tags mfa
+// @Produce json
+// @Success 200 {object} MFAEnrollResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/user/mfa/enroll [post]
+func EnrollMFA(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, principal.UserID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	if user.MFAEnabled() {
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{"Already enabled", "Two-factor authentication is already enabled"})
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot generate secret", err.Error()})
+	}
+
+	if err := db.DB.Model(&user).Update("totp_pending_secret", secret).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot save secret", err.Error()})
+	}
+
+	return c.JSON(MFAEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(user.Email, secret),
+	})
+}
+
+// ConfirmMFA godoc
+// @Summary Confirm TOTP enrolment
+// @Description Enable two-factor authentication with the first code from the authenticator app and receive recovery codes
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param mfa body validators.MFACodeInput true "TOTP code"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/user/mfa/confirm [post]
+func ConfirmMFA(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, principal.UserID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	var data validators.MFACodeInput
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	if user.TOTPPendingSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"No enrolment in progress", "Call /api/user/mfa/enroll first"})
+	}
+
+	step, valid := auth.ValidateTOTP(user.TOTPPendingSecret, data.Code, 0, time.Now())
+	if !valid {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid code", "The code does not match the secret"})
+	}
+
+	var codes []string
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":         user.TOTPPendingSecret,
+			"totp_pending_secret": "",
+			"totp_last_step":      step,
+			"mfa_enabled_at":      now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if codes, err = replaceRecoveryCodes(tx, user.ID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{Action: "user.mfa_enable", Target: userTarget(user.ID)})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot enable two-factor authentication", err.Error()})
+	}
+
+	return c.JSON(RecoveryCodesResponse{Message: "Two-factor authentication enabled", RecoveryCodes: codes})
+}
+
+// DisableMFA godoc
+// @Summary Disable two-factor authentication
+// @Description Disable TOTP for the authenticated user. Requires the password and a TOTP or recovery code. Accounts without a password, such as those created through a social login, must have logged in within the last 5 minutes instead.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param mfa body validators.DisableMFAInput true "Password and code"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/user/mfa/disable [post]
+func DisableMFA(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, principal.UserID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	var data validators.DisableMFAInput
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	if !user.MFAEnabled() {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Not enabled", "Two-factor authentication is not enabled"})
+	}
+
+	if ok, resp := reauthenticate(c, principal, &user, data.Password, "disable two-factor authentication"); ok {
+		return resp
+	}
+
+	if !checkSecondFactor(&user, data.Code, data.RecoveryCode) {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Invalid code", "The code is incorrect or has already been used"})
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := disableMFA(tx, user.ID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{Action: "user.mfa_disable", Target: userTarget(user.ID)})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot disable two-factor authentication", err.Error()})
+	}
+
+	return c.JSON(SuccessResponse{Message: "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes of the authenticated user. Requires a current TOTP code.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param mfa body validators.MFACodeInput true "TOTP code"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/user/mfa/recovery-codes [post]
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, principal.UserID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"user not found", "No user with the given ID"})
+	}
+
+	var data validators.MFACodeInput
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	if !user.MFAEnabled() {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Not enabled", "Two-factor authentication is not enabled"})
+	}
+
+	if !checkSecondFactor(&user, data.Code, "") {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Invalid code", "The code is incorrect or has already been used"})
+	}
+
+	var codes []string
+	err := db.DB.Transaction(func(tx *gorm.DB) (err error) {
+		if codes, err = replaceRecoveryCodes(tx, user.ID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{Action: "user.recovery_codes_regenerate", Target: userTarget(user.ID)})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot regenerate recovery codes", err.Error()})
+	}
+
+	return c.JSON(RecoveryCodesResponse{Message: "Recovery codes regenerated", RecoveryCodes: codes})
+}
+
+// checkSecondFactor verifies a TOTP code, or else a recovery code, for the user.
+// A valid TOTP code moves the user's last step forward so it cannot be replayed;
+// a valid recovery code is marked as used.
+func checkSecondFactor(user *models.User, code, recoveryCode string) bool {
+	if code != "" {
+		step, ok := auth.ValidateTOTP(user.TOTPSecret, code, user.TOTPLastStep, time.Now())
+		if !ok {
+			return false
+		}
+
+		// Only one request can move the step forward, which rejects concurrent replays
+		result := db.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return false
+		}
+		user.TOTPLastStep = step
+		return true
+	}
+
+	if recoveryCode != "" {
+		result := db.DB.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, auth.HashRecoveryCode(recoveryCode)).
+			Update("used_at", time.Now())
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	return false
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores a new set,
+// returning the plain codes so they can be shown once
+func replaceRecoveryCodes(tx *gorm.DB, userID int) ([]string, error) {
+	codes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]models.RecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		rows = append(rows, models.RecoveryCode{UserID: userID, CodeHash: auth.HashRecoveryCode(code)})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// disableMFA turns off two-factor authentication for the user and deletes the recovery codes
+func disableMFA(tx *gorm.DB, userID int) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_secret":         "",
+			"totp_pending_secret": "",
+			"totp_last_step":      0,
+			"mfa_enabled_at":      nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/oidc"
+	"github.com/raihan1405/go-restapi/validators"
+	"gorm.io/gorm"
+)
+
+const (
+	// oidcStateCookie binds a login started with a provider to the browser that started it
+	oidcStateCookie = "oidc_state"
+	// oidcLoginTTL is how long the user has to come back from the provider
+	oidcLoginTTL = 10 * time.Minute
+)
+
+// errOIDCEmailNotVerified is returned when a new identity cannot be linked
+// because the provider has not verified its email address
+var errOIDCEmailNotVerified = errors.New("the provider has not verified the email address of this account")
+
+// OIDCProvidersResponse lists the providers users can log in with
+type OIDCProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+// OIDCAuthorizationResponse contains the provider page to send the user to
+type OIDCAuthorizationResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+}
+
+// OIDCRedirectURL is the default page providers send users back to,
+// /login/oidc/<provider>/callback on the frontend. The page posts the code
+// and state it receives to OIDCCallback.
+func OIDCRedirectURL(provider string) string {
+	return frontendURL("/login/oidc/"+provider+"/callback", nil)
+}
+
+// GetOIDCProviders godoc
+// @Summary List social login providers
+// @Description List the names of the configured OpenID Connect providers
+// @Tags auth
+// @Produce json
+// @Success 200 {object} OIDCProvidersResponse
+// @Router /api/login/oidc [get]
+func GetOIDCProviders(c *fiber.Ctx) error {
+	return c.JSON(OIDCProvidersResponse{Providers: oidc.Names()})
+}
+
+// StartOIDCLogin godoc
+// @Summary Start a social login
+// @Description Start an authorization code flow with PKCE at the provider. The client sends the user to the returned URL; the state is also bound to the browser with a cookie.
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} OIDCAuthorizationResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/login/oidc/{provider} [post]
+func StartOIDCLogin(c *fiber.Ctx) error {
+	provider, err := oidc.Lookup(c.Params("provider"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"provider not found", err.Error()})
+	}
+
+	request, err := provider.NewAuthRequest(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(ErrorResponse{"Cannot reach identity provider", err.Error()})
+	}
+
+	// Buang login yang tidak pernah diselesaikan
+	now := time.Now()
+	db.DB.Where("expires_at < ?", now).Delete(&models.OIDCLogin{})
+
+	login := models.OIDCLogin{
+		StateHash:    auth.HashToken(request.State),
+		Provider:     provider.Name,
+		Nonce:        request.Nonce,
+		CodeVerifier: request.CodeVerifier,
+		ExpiresAt:    now.Add(oidcLoginTTL),
+	}
+	if err := db.DB.Create(&login).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot start login", err.Error()})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    request.State,
+		Path:     "/api/login/oidc",
+		Expires:  login.ExpiresAt,
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: "None",
+	})
+
+	return c.JSON(OIDCAuthorizationResponse{AuthorizationURL: request.URL})
+}
+
+// OIDCCallback godoc
+// @Summary Complete a social login
+// @Description Exchange the code the provider returned for a session. The identity is linked to the user with the same verified email, or a new customer account is created. Users with two-factor authentication get an MFA challenge token instead, to be completed at /api/login/mfa.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param callback body validators.OIDCCallbackInput true "Code and state returned by the provider"
+// @Success 200 {object} LoginResponse
+// @Success 202 {object} MFAChallengeResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/login/oidc/{provider}/callback [post]
+func OIDCCallback(c *fiber.Ctx) error {
+	provider, err := oidc.Lookup(c.Params("provider"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"provider not found", err.Error()})
+	}
+
+	var data validators.OIDCCallbackInput
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	// The state must come back to the browser that started the login
+	if c.Cookies(oidcStateCookie) != data.State {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid state", "The login was started in another browser or has expired"})
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		Path:     "/api/login/oidc",
+		Expires:  time.Now().Add(-time.Hour),
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: "None",
+	})
+
+	// Each state can only be used once
+	var login models.OIDCLogin
+	err = db.DB.Where("state_hash = ? AND provider = ? AND expires_at > ?", auth.HashToken(data.State), provider.Name, time.Now()).
+		First(&login).Error
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid state", "The login was started in another browser or has expired"})
+	}
+	result := db.DB.Where("state_hash = ?", login.StateHash).Delete(&models.OIDCLogin{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid state", "The login has already been completed"})
+	}
+
+	identity, err := provider.Exchange(c.Context(), data.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"Login with provider failed", err.Error()})
+	}
+
+	user, err := linkOIDCIdentity(identity)
+	if errors.Is(err, errOIDCEmailNotVerified) {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{"Email not verified", err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Could not login", err.Error()})
+	}
+
+	return completeLogin(c, user)
+}
+
+// linkOIDCIdentity returns the user an external identity belongs to. Identities
+// seen for the first time are linked by verified email to an existing user, or
+// get a new customer account.
+func linkOIDCIdentity(identity *oidc.Identity) (models.User, error) {
+	var user models.User
+	now := time.Now()
+	email := validators.NormalizeEmail(identity.Email)
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var link models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&link).Error
+		if err == nil {
+			if err := tx.Model(&link).Updates(map[string]interface{}{"email": email, "last_login_at": now}).Error; err != nil {
+				return err
+			}
+			return tx.First(&user, link.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if email == "" || !identity.EmailVerified {
+			return errOIDCEmailNotVerified
+		}
+
+		err = tx.Where("email = ?", email).First(&user).Error
+		switch {
+		case err == nil && !user.IsVerified():
+			// The provider proved who owns the address. Whoever registered it
+			// without confirming it loses the password and sessions they set up.
+			err = tx.Model(&user).Updates(map[string]interface{}{"verified_at": now, "password": nil}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Model(&models.Session{}).
+				Where("user_id = ? AND revoked_at IS NULL", user.ID).
+				Update("revoked_at", now).Error
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			user, err = createOIDCUser(tx, email, identity, now)
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    identity.Provider,
+			Subject:     identity.Subject,
+			Email:       email,
+			LastLoginAt: &now,
+		}).Error
+	})
+
+	return user, err
+}
+
+// createOIDCUser creates a verified customer account without a password for the identity
+func createOIDCUser(tx *gorm.DB, email string, identity *oidc.Identity, now time.Time) (models.User, error) {
+	var customer models.Role
+	if err := tx.Where("name = ?", models.RoleCustomer).First(&customer).Error; err != nil {
+		return models.User{}, err
+	}
+
+	username := identity.PreferredUsername
+	if username == "" {
+		username = identity.Name
+	}
+	if username == "" {
+		username, _, _ = strings.Cut(email, "@")
+	}
+
+	username, err := availableUsername(tx, username)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{
+		Email:      email,
+		Username:   username,
+		Roles:      []models.Role{customer},
+		VerifiedAt: &now,
+	}
+	return user, tx.Create(&user).Error
+}
+
+// availableUsername returns the username, or the username with a random
+// number appended when it is already taken
+func availableUsername(tx *gorm.DB, username string) (string, error) {
+	candidate := username
+	for i := 0; i < 10; i++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", username, 1000+rand.Intn(9000))
+	}
+	return "", errors.New("cannot find a free username")
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/db/dbtest"
+	"github.com/raihan1405/go-restapi/oidc"
+)
+
+// respondWithUser answers lookups of users with the given row and finds no
+// linked identities
+func respondWithUser(verifiedAt interface{}) func(string) ([]string, [][]driver.Value) {
+	return func(query string) ([]string, [][]driver.Value) {
+		if strings.Contains(query, "FROM `users`") {
+			return []string{"id", "email", "username", "verified_at"},
+				[][]driver.Value{{int64(7), "buyer@example.com", "buyer", verifiedAt}}
+		}
+		return []string{"id"}, nil
+	}
+}
+
+func TestLinkOIDCIdentityByVerifiedEmail(t *testing.T) {
+	fake := dbtest.Use(t, respondWithUser(time.Now()))
+
+	user, err := linkOIDCIdentity(&oidc.Identity{Provider: "mock", Subject: "subject-1", Email: "Buyer@Example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 7 {
+		t.Fatalf("linked to user %d, want 7", user.ID)
+	}
+
+	args, ok := fake.Executed("INSERT INTO `user_identities`")
+	if !ok {
+		t.Fatal("no identity was linked")
+	}
+	if args[0] != int64(7) || args[1] != "mock" || args[2] != "subject-1" || args[3] != "buyer@example.com" {
+		t.Errorf("identity linked with %v", args)
+	}
+	if _, ok := fake.Executed("INSERT INTO `users`"); ok {
+		t.Error("no new user should be created for a known email")
+	}
+	if _, ok := fake.Executed("UPDATE `users`"); ok {
+		t.Error("a verified user should be left as it is")
+	}
+}
+
+func TestLinkOIDCIdentityTakesOverUnverifiedAccount(t *testing.T) {
+	fake := dbtest.Use(t, respondWithUser(nil))
+
+	if _, err := linkOIDCIdentity(&oidc.Identity{Provider: "mock", Subject: "subject-1", Email: "buyer@example.com", EmailVerified: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := fake.Executed("UPDATE `users` SET `password`=?,`verified_at`=?"); !ok {
+		t.Error("the password of the unverified account should be cleared")
+	}
+	if _, ok := fake.Executed("UPDATE `sessions` SET `revoked_at`=?"); !ok {
+		t.Error("the sessions of the unverified account should be revoked")
+	}
+}
+
+func TestLinkOIDCIdentityRefusesUnverifiedEmail(t *testing.T) {
+	fake := dbtest.Use(t, respondWithUser(time.Now()))
+
+	_, err := linkOIDCIdentity(&oidc.Identity{Provider: "mock", Subject: "subject-1", Email: "buyer@example.com", EmailVerified: false})
+	if !errors.Is(err, errOIDCEmailNotVerified) {
+		t.Fatalf("linkOIDCIdentity = %v, want errOIDCEmailNotVerified", err)
+	}
+	if _, ok := fake.Executed("INSERT"); ok {
+		t.Error("nothing should be linked or created for an unverified email")
+	}
+	if _, ok := fake.Executed("SELECT * FROM `users`"); ok {
+		t.Error("an unverified email should not even be looked up")
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	fake := dbtest.Use(t, func(string) ([]string, [][]driver.Value) { return []string{"state_hash"}, nil })
+
+	previous := oidc.Providers
+	oidc.Providers = map[string]*oidc.Provider{"mock": {Name: "mock"}}
+	t.Cleanup(func() { oidc.Providers = previous })
+
+	app := fiber.New()
+	app.Post("/api/login/oidc/:provider/callback", OIDCCallback)
+
+	tests := []struct {
+		name   string
+		cookie string
+		lookup bool
+	}{
+		{"no cookie", "", false},
+		{"cookie from another login", "state-2", false},
+		{"state not started here", "state-1", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodPost, "/api/login/oidc/mock/callback", strings.NewReader(`{"code":"code-1","state":"state-1"}`))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			if test.cookie != "" {
+				req.Header.Set(fiber.HeaderCookie, oidcStateCookie+"="+test.cookie)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != fiber.StatusBadRequest {
+				t.Fatalf("status %d, want 400", resp.StatusCode)
+			}
+
+			_, looked := fake.Executed("SELECT * FROM `o_id_c_logins`")
+			if looked != test.lookup {
+				t.Errorf("pending login looked up: %v, want %v", looked, test.lookup)
+			}
+		})
+	}
+}
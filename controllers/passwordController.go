@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/mailer"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/passwords"
+	"github.com/raihan1405/go-restapi/validators"
+	"gorm.io/gorm"
+)
+
+// passwordResetTTL is how long a password reset link stays valid
+const passwordResetTTL = time.Hour
+
+// ForgotPassword godoc
+// @Summary Request a password reset link
+// @Description Email a single-use password reset link. The response is the same whether or not the email belongs to an account.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param forgot body validators.ForgotPasswordInput true "Account email"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/password/forgot [post]
+func ForgotPassword(c *fiber.Ctx) error {
+	var data validators.ForgotPasswordInput
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	// Kirim email di background agar waktu respons tidak membocorkan apakah email terdaftar
+	go sendPasswordReset(validators.NormalizeEmail(data.Email))
+
+	return c.JSON(SuccessResponse{Message: "If an account exists for this email, a password reset link has been sent"})
+}
+
+// sendPasswordReset issues a reset token for the account with the email, if any, and mails it
+func sendPasswordReset(email string) {
+	var user models.User
+	if err := db.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		return
+	}
+
+	token, err := auth.IssueOneTimeToken(user.ID, models.TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		log.Printf("cannot issue password reset token for user %d: %v", user.ID, err)
+		return
+	}
+
+	link := frontendURL("/reset-password", url.Values{"token": {token}})
+	err = mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can only be used once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.Username, passwordResetTTL, link),
+	})
+	if err != nil {
+		log.Printf("cannot send password reset email to user %d: %v", user.ID, err)
+	}
+}
+
+// ResetPassword godoc
+// @Summary Reset password with a reset token
+// @Description Set a new password using the token from the password reset email. All sessions of the account are revoked.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param reset body validators.ResetPasswordInput true "Reset token and new password"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/password/reset [post]
+func ResetPassword(c *fiber.Ctx) error {
+	var data validators.ResetPasswordInput
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	if err := passwords.Check(data.NewPassword); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Password does not meet the policy", err.Error()})
+	}
+
+	password, err := passwords.Hash(data.NewPassword)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot hash password", err.Error()})
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := auth.ConsumeOneTimeToken(tx, data.Token, models.TokenPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.User{}).Where("id = ?", token.UserID).Update("password", password).Error; err != nil {
+			return err
+		}
+
+		// Whoever knew the old password must not stay logged in
+		revoked, err := auth.RevokeUserSessions(tx, token.UserID, "")
+		if err != nil {
+			return err
+		}
+
+		return audit.Record(tx, userActor(c, token.UserID), audit.Event{
+			Action:  "auth.password_reset",
+			Target:  userTarget(token.UserID),
+			Details: fiber.Map{"revokedSessions": revoked},
+		})
+	})
+	if errors.Is(err, auth.ErrInvalidOneTimeToken) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid reset token", err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot reset password", err.Error()})
+	}
+
+	return c.JSON(SuccessResponse{Message: "Password has been reset"})
+}
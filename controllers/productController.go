@@ -1,42 +1,41 @@
 package controllers
 
 import (
+	"errors"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	//"github.com/golang-jwt/jwt/v4" // Menggunakan jwt dari golang-jwt/jwt/v4
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
 	"github.com/raihan1405/go-restapi/db"
 	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/search"
 	"github.com/raihan1405/go-restapi/validators"
+	"gorm.io/gorm"
 )
 
 // AddProduct godoc
 // @Summary Add a new product
-// @Description Add a new product with the provided details
+// @Description Add a new product with the provided details. Sellers can only use brands without an owner or brands they own.
 // @Tags product
 // @Accept json
 // @Produce json
 // @Param product body validators.AddProductInput true "Product details"
 // @Success 200 {object} models.Product
 // @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/products [post]
 func AddProduct(c *fiber.Ctx) error {
-	// Mendapatkan user dari context (yang di-set oleh middleware JWT)
-	// user, ok := c.Locals("user").(*jwt.Token)
-	// if !ok {
-	// 	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
-	// }
-
-	// claims, ok := user.Claims.(jwt.MapClaims)
-	// if !ok {
-	// 	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token claims"})
-	// }
-
-	// userID, ok := claims["sub"].(string)
-	// if !ok || userID == "" {
-	// 	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user ID in token"})
-	// }
+	// Mendapatkan user dari context (yang di-set oleh middleware auth)
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(map[string]interface{}{"error": "Unauthorized"})
+	}
 
 	var data validators.AddProductInput
 
@@ -50,50 +49,264 @@ func AddProduct(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
 	}
 
+	category, err := resolveProductCategory(data.CategoryID, data.Category)
+	if errors.Is(err, errUnknownCategory) {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": "Unknown category"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot retrieve category"})
+	}
+
+	brand, err := resolveProductBrand(data.BrandID, data.BrandName)
+	if errors.Is(err, errUnknownBrand) {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": "Unknown brand"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot retrieve brand"})
+	}
+	if !canUseBrand(principal, brand) {
+		return c.Status(fiber.StatusForbidden).JSON(map[string]interface{}{"error": "This brand belongs to another seller"})
+	}
+
 	// Set status based on quantity
 	status := data.Quantity > 0
 
 	// Create product
 	product := models.Product{
 		ProductName: data.ProductName,
-		BrandName:   data.BrandName,
+		BrandName:   brand.Name,
+		BrandID:     &brand.ID,
 		Price:       int(data.Price),
 		Status:      status,
 		Quantity:    data.Quantity,
-		Category:    data.Category, // Menyimpan Category
+		Category:    category.Name, // Nama kategori disimpan bersama ID-nya
+		CategoryID:  &category.ID,
+		UserID:      strconv.Itoa(principal.UserID),
 	}
 
 	// Save product to database
-	if err := db.DB.Create(&product).Error; err != nil {
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&product).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "product.create",
+			Target: productTarget(product.ID),
+			After:  product,
+		})
+	})
+	if db.NoReferencedRow(err) {
+		// Kategori atau brand-nya dihapus setelah dicari di atas
+		return c.Status(fiber.StatusConflict).JSON(map[string]interface{}{"error": "The category or brand no longer exists"})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot save product"})
 	}
 
+	// Produk baru langsung bisa dicari
+	search.IndexProduct(product)
+
 	return c.JSON(product)
 }
 
 
+// ProductListResponse is one page of products
+type ProductListResponse struct {
+	Products []models.Product `json:"products"`
+	Total    int64            `json:"total"`
+	Limit    int              `json:"limit"`
+	Page     int              `json:"page,omitempty"`
+	Links    PageLinks        `json:"links"`
+}
+
+// PageLinks are the URLs of the current, next and previous page
+type PageLinks struct {
+	Self string `json:"self"`
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
 // GetAllProducts godoc
 // @Summary Get all products
-// @Description Get a list of all products
+// @Description Get one page of products, filtered and sorted. Pages are addressed by cursor (follow links.next and links.prev) or, when page is given, by offset. Sort fields are id, price, quantity, productName, brandName and category; prefix a field with - to sort in descending order.
 // @Tags product
 // @Produce json
-// @Success 200 {array} models.Product
+// @Param category query string false "Category name or slug; products in its subcategories are included"
+// @Param category_id query int false "Category ID; products in its subcategories are included"
+// @Param brand query string false "Brand name"
+// @Param brand_id query int false "Brand ID"
+// @Param min_price query int false "Lowest price"
+// @Param max_price query int false "Highest price"
+// @Param in_stock query bool false "Only products that are (true) or are not (false) in stock"
+// @Param seller query int false "ID of the seller"
+// @Param sort query string false "Sort order, such as -price,productName" default(id)
+// @Param limit query int false "Products per page, at most 100" default(20)
+// @Param page query int false "Page number for offset pagination, from 1"
+// @Param cursor query string false "Cursor from links.next or links.prev"
+// @Success 200 {object} ProductListResponse
+// @Failure 400 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/products [get]
 func GetAllProducts(c *fiber.Ctx) error {
-	var products []models.Product
+	var params validators.ProductListQuery
+	if err := c.QueryParser(&params); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid query parameters"})
+	}
+	if err := validators.Validate.Struct(params); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
+	}
+	if params.MinPrice != nil && params.MaxPrice != nil && *params.MinPrice > *params.MaxPrice {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": "min_price cannot be greater than max_price"})
+	}
+	if params.Page > 0 && params.Cursor != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": "Use either page or cursor, not both"})
+	}
+	if params.Limit == 0 {
+		params.Limit = 20
+	}
+
+	sort, err := parseProductSort(params.Sort)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
+	}
+
+	// Filter hanya memakai kolom yang sudah ditentukan, nilainya selalu sebagai parameter
+	query := db.DB.Model(&models.Product{})
+	if params.Category != "" {
+		categories, err := categorySubtreeByName(params.Category)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot retrieve categories"})
+		}
+		ids := []int{}
+		for _, category := range categories {
+			ids = append(ids, category.ID)
+		}
+		query = query.Where("category_id IN ?", ids)
+	}
+	if params.CategoryID != nil {
+		ids, err := categoryDescendants(*params.CategoryID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot retrieve categories"})
+		}
+		query = query.Where("category_id IN ?", ids)
+	}
+	if params.Brand != "" {
+		query = query.Where("brand_name = ?", params.Brand)
+	}
+	if params.BrandID != nil {
+		query = query.Where("brand_id = ?", *params.BrandID)
+	}
+	if params.MinPrice != nil {
+		query = query.Where("price >= ?", *params.MinPrice)
+	}
+	if params.MaxPrice != nil {
+		query = query.Where("price <= ?", *params.MaxPrice)
+	}
+	if params.InStock != nil {
+		query = query.Where("status = ?", *params.InStock)
+	}
+	if params.Seller != nil {
+		query = query.Where("user_id = ?", strconv.Itoa(*params.Seller))
+	}
 
-	// Retrieve all products from the database
-	if err := db.DB.Find(&products).Error; err != nil {
+	response := ProductListResponse{Products: []models.Product{}, Limit: params.Limit}
+	if err := query.Count(&response.Total).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot retrieve products"})
 	}
 
-	return c.JSON(products)
+	link := func(key, value string) string {
+		values, _ := url.ParseQuery(string(c.Request().URI().QueryString()))
+		values.Del("page")
+		values.Del("cursor")
+		values.Set(key, value)
+		return c.BaseURL() + c.Path() + "?" + values.Encode()
+	}
+	response.Links.Self = c.BaseURL() + c.OriginalURL()
+
+	// Offset pagination
+	if params.Page > 0 {
+		err := sort.order(query, false).Offset((params.Page - 1) * params.Limit).Limit(params.Limit).Find(&response.Products).Error
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot retrieve products"})
+		}
+
+		response.Page = params.Page
+		if int64(params.Page*params.Limit) < response.Total {
+			response.Links.Next = link("page", strconv.Itoa(params.Page+1))
+		}
+		if params.Page > 1 {
+			response.Links.Prev = link("page", strconv.Itoa(params.Page-1))
+		}
+		return c.JSON(response)
+	}
+
+	// Cursor pagination. One extra row tells whether there is another page.
+	var cursor *productCursor
+	if params.Cursor != "" {
+		if cursor, err = sort.decodeCursor(params.Cursor); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
+		}
+		query = sort.after(query, cursor)
+	}
+	backward := cursor != nil && cursor.Before
+
+	if err := sort.order(query, backward).Limit(params.Limit + 1).Find(&response.Products).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot retrieve products"})
+	}
+
+	more := len(response.Products) > params.Limit
+	if more {
+		response.Products = response.Products[:params.Limit]
+	}
+	if backward {
+		for i, j := 0, len(response.Products)-1; i < j; i, j = i+1, j-1 {
+			response.Products[i], response.Products[j] = response.Products[j], response.Products[i]
+		}
+	}
+
+	if n := len(response.Products); n > 0 {
+		// The extra row means there is more in the direction we are paging in;
+		// the other direction has more whenever we got here with a cursor
+		hasNext, hasPrev := more, cursor != nil
+		if backward {
+			hasNext, hasPrev = true, more
+		}
+		if hasNext {
+			response.Links.Next = link("cursor", sort.cursorAt(response.Products[n-1], false))
+		}
+		if hasPrev {
+			response.Links.Prev = link("cursor", sort.cursorAt(response.Products[0], true))
+		}
+	}
+
+	return c.JSON(response)
+}
+
+// GetProduct godoc
+// @Summary Get a product
+// @Description Get a single product by ID. Deleted products are not found.
+// @Tags product
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {object} models.Product
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/products/{id} [get]
+func GetProduct(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid product ID"})
+	}
+
+	var product models.Product
+	if err := db.DB.First(&product, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(map[string]interface{}{"error": "Product not found"})
+	}
+
+	return c.JSON(product)
 }
 
 // EditProduct godoc
 // @Summary Edit an existing product
-// @Description Edit an existing product with the provided details
+// @Description Edit an existing product with the provided details. Sellers can only edit their own products, admins can edit any product. Sellers can only switch to brands without an owner or brands they own.
 // @Tags product
 // @Accept json
 // @Produce json
@@ -101,10 +314,18 @@ func GetAllProducts(c *fiber.Ctx) error {
 // @Param product body validators.EditProductInput true "Product details"
 // @Success 200 {object} models.Product
 // @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/products/{id} [put]
 func EditProduct(c *fiber.Ctx) error {
+    principal, ok := auth.GetPrincipal(c)
+    if !ok {
+        return c.Status(fiber.StatusUnauthorized).JSON(map[string]interface{}{"error": "Unauthorized"})
+    }
+
     // Ambil ID produk dari parameter URL
     id, err := strconv.Atoi(c.Params("id"))
     if err != nil {
@@ -133,19 +354,219 @@ func EditProduct(c *fiber.Ctx) error {
         return c.Status(fiber.StatusNotFound).JSON(map[string]interface{}{"error": "Product not found"})
     }
 
+    // Seller hanya boleh mengubah produk miliknya sendiri
+    if !canWriteProduct(principal, product) {
+        return c.Status(fiber.StatusForbidden).JSON(map[string]interface{}{"error": "You can only edit your own products"})
+    }
+
+    category, err := resolveProductCategory(data.CategoryID, data.Category)
+    if errors.Is(err, errUnknownCategory) {
+        return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": "Unknown category"})
+    } else if err != nil {
+        return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot retrieve category"})
+    }
+
+    brand, err := resolveProductBrand(data.BrandID, data.BrandName)
+    if errors.Is(err, errUnknownBrand) {
+        return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": "Unknown brand"})
+    } else if err != nil {
+        return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot retrieve brand"})
+    }
+    // Brand yang sudah dipakai produk ini tetap boleh dipertahankan
+    keepsBrand := product.BrandID != nil && *product.BrandID == brand.ID
+    if !keepsBrand && !canUseBrand(principal, brand) {
+        return c.Status(fiber.StatusForbidden).JSON(map[string]interface{}{"error": "This brand belongs to another seller"})
+    }
+
+    before := product
+
     // Perbarui detail produk
     product.ProductName = data.ProductName
-    product.BrandName = data.BrandName
-    product.Category = data.Category
+    product.BrandName = brand.Name
+    product.BrandID = &brand.ID
+    product.Category = category.Name
+    product.CategoryID = &category.ID
     product.Price = int(data.Price)
     product.Quantity = data.Quantity
     product.Status = data.Quantity > 0
 
     // Simpan perubahan ke database
-    if err := db.DB.Save(&product).Error; err != nil {
+    err = db.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Save(&product).Error; err != nil {
+            return err
+        }
+
+        return audit.Record(tx, auditActor(c), audit.Event{
+            Action: "product.update",
+            Target: productTarget(product.ID),
+            Before: before,
+            After:  product,
+        })
+    })
+    if db.NoReferencedRow(err) {
+        // Kategori atau brand-nya dihapus setelah dicari di atas
+        return c.Status(fiber.StatusConflict).JSON(map[string]interface{}{"error": "The category or brand no longer exists"})
+    } else if err != nil {
         return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot update product"})
     }
 
+    // Perbarui indeks pencarian
+    search.IndexProduct(product)
+
     // Kembalikan produk yang telah diperbarui sebagai respon
     return c.JSON(product)
 }
+
+// DeleteProduct godoc
+// @Summary Delete a product
+// @Description Remove a product from the catalogue. The product is kept for carts that already contain it, where it is flagged as unavailable, and can be restored by an admin. Sellers can only delete their own products.
+// @Tags product
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/products/{id} [delete]
+func DeleteProduct(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(map[string]interface{}{"error": "Unauthorized"})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid product ID"})
+	}
+
+	var product models.Product
+	if err := db.DB.First(&product, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(map[string]interface{}{"error": "Product not found"})
+	}
+
+	// Seller hanya boleh menghapus produk miliknya sendiri
+	if !canWriteProduct(principal, product) {
+		return c.Status(fiber.StatusForbidden).JSON(map[string]interface{}{"error": "You can only delete your own products"})
+	}
+
+	// Soft delete, with the timestamp set here so the audit log has the stored value
+	now := time.Now()
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&product).Update("deleted_at", now).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "product.delete",
+			Target: productTarget(product.ID),
+			Before: fiber.Map{"deletedAt": nil},
+			After:  fiber.Map{"deletedAt": now},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot delete product"})
+	}
+
+	search.RemoveProduct(product.ID)
+	return c.JSON(SuccessResponse{Message: "Product deleted"})
+}
+
+// RestoreProduct godoc
+// @Summary Restore a deleted product
+// @Description Put a deleted product back into the catalogue
+// @Tags admin
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {object} models.Product
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/admin/products/{id}/restore [post]
+func RestoreProduct(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid product ID"})
+	}
+
+	var product models.Product
+	if err := db.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&product, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(map[string]interface{}{"error": "Deleted product not found"})
+	}
+
+	deletedAt := product.DeletedAt
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&product).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "product.restore",
+			Target: productTarget(product.ID),
+			Before: fiber.Map{"deletedAt": deletedAt},
+			After:  fiber.Map{"deletedAt": nil},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot restore product"})
+	}
+
+	product.DeletedAt = gorm.DeletedAt{}
+	search.IndexProduct(product)
+	return c.JSON(product)
+}
+
+// PurgeProduct godoc
+// @Summary Permanently delete a product
+// @Description Remove a deleted product from the database for good, together with the cart lines that still refer to it. Only products that have been deleted can be purged.
+// @Tags admin
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/admin/products/{id} [delete]
+func PurgeProduct(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid product ID"})
+	}
+
+	var product models.Product
+	if err := db.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&product, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(map[string]interface{}{"error": "Deleted product not found"})
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("product_id = ?", product.ID).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&product).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action: "product.purge",
+			Target: productTarget(product.ID),
+			Before: product,
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot purge product"})
+	}
+
+	search.RemoveProduct(product.ID)
+	return c.JSON(SuccessResponse{Message: "Product purged"})
+}
+
+// canWriteProduct reports whether the principal may modify the product
+func canWriteProduct(principal *auth.Principal, product models.Product) bool {
+	if principal.Can(auth.PermProductWriteAny) {
+		return true
+	}
+	return product.UserID == strconv.Itoa(principal.UserID)
+}
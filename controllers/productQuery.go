@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/raihan1405/go-restapi/models"
+	"gorm.io/gorm"
+)
+
+// productSortField is a field products can be sorted by. Only fields listed in
+// productSortFields reach SQL, so request input never becomes a column name.
+type productSortField struct {
+	column  string
+	numeric bool
+	value   func(models.Product) interface{}
+}
+
+// productSortFields maps the names accepted in ?sort= to their columns
+var productSortFields = map[string]productSortField{
+	"id":          {"id", true, func(p models.Product) interface{} { return p.ID }},
+	"price":       {"price", true, func(p models.Product) interface{} { return p.Price }},
+	"quantity":    {"quantity", true, func(p models.Product) interface{} { return p.Quantity }},
+	"productName": {"product_name", false, func(p models.Product) interface{} { return p.ProductName }},
+	"brandName":   {"brand_name", false, func(p models.Product) interface{} { return p.BrandName }},
+	"category":    {"category", false, func(p models.Product) interface{} { return p.Category }},
+}
+
+// productSortKey is one field of a sort order
+type productSortKey struct {
+	field productSortField
+	desc  bool
+}
+
+// productSort is a parsed sort order. It always ends with the ID, so that
+// products are in a total order and a cursor points at exactly one place.
+type productSort struct {
+	spec string
+	keys []productSortKey
+}
+
+var errInvalidCursor = errors.New("cursor is malformed or was issued for a different sort order")
+
+// parseProductSort parses a sort order such as "-price,productName"
+func parseProductSort(spec string) (productSort, error) {
+	sort := productSort{spec: spec}
+	seen := map[string]bool{}
+
+	if spec != "" {
+		for _, name := range strings.Split(spec, ",") {
+			desc := strings.HasPrefix(name, "-")
+			name = strings.TrimPrefix(name, "-")
+
+			field, ok := productSortFields[name]
+			if !ok {
+				return sort, fmt.Errorf("cannot sort by %q", name)
+			}
+			if seen[name] {
+				return sort, fmt.Errorf("%q appears more than once in the sort order", name)
+			}
+			seen[name] = true
+			sort.keys = append(sort.keys, productSortKey{field, desc})
+		}
+	}
+
+	if !seen["id"] {
+		sort.keys = append(sort.keys, productSortKey{field: productSortFields["id"]})
+	}
+	return sort, nil
+}
+
+// order applies the sort order to the query, reversed when paging backwards
+func (s productSort) order(query *gorm.DB, reverse bool) *gorm.DB {
+	for _, key := range s.keys {
+		direction := "ASC"
+		if key.desc != reverse {
+			direction = "DESC"
+		}
+		query = query.Order(key.field.column + " " + direction)
+	}
+	return query
+}
+
+// productCursor marks a position in a sorted product list. Before is set for
+// cursors that page backwards from the position.
+type productCursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+	Before bool          `json:"b,omitempty"`
+}
+
+// cursorAt returns the encoded cursor of the product's position
+func (s productSort) cursorAt(product models.Product, before bool) string {
+	cursor := productCursor{Sort: s.spec, Before: before}
+	for _, key := range s.keys {
+		cursor.Values = append(cursor.Values, key.field.value(product))
+	}
+
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// decodeCursor decodes a cursor issued for this sort order
+func (s productSort) decodeCursor(raw string) (*productCursor, error) {
+	encoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(encoded)))
+	decoder.UseNumber()
+	var cursor productCursor
+	if err := decoder.Decode(&cursor); err != nil || cursor.Sort != s.spec || len(cursor.Values) != len(s.keys) {
+		return nil, errInvalidCursor
+	}
+
+	// Every value has to have the type of its column
+	for i, key := range s.keys {
+		switch value := cursor.Values[i].(type) {
+		case json.Number:
+			n, err := value.Int64()
+			if err != nil || !key.field.numeric {
+				return nil, errInvalidCursor
+			}
+			cursor.Values[i] = n
+		case string:
+			if key.field.numeric {
+				return nil, errInvalidCursor
+			}
+		default:
+			return nil, errInvalidCursor
+		}
+	}
+	return &cursor, nil
+}
+
+// after restricts the query to the products after the cursor, or before it
+// for backward cursors. For the order a, -b, id it builds
+// (a > ?) OR (a = ? AND b < ?) OR (a = ? AND b = ? AND id > ?).
+func (s productSort) after(query *gorm.DB, cursor *productCursor) *gorm.DB {
+	var clauses []string
+	var args []interface{}
+
+	for i, key := range s.keys {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, s.keys[j].field.column+" = ?")
+			args = append(args, cursor.Values[j])
+		}
+
+		op := ">"
+		if key.desc != cursor.Before {
+			op = "<"
+		}
+		parts = append(parts, key.field.column+" "+op+" ?")
+		args = append(args, cursor.Values[i])
+
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	return query.Where(strings.Join(clauses, " OR "), args...)
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/db/dbtest"
+	"github.com/raihan1405/go-restapi/models"
+	"gorm.io/gorm"
+)
+
+// sortColumns lists the columns of a sort order, with "-" for descending
+func sortColumns(sort productSort) []string {
+	var columns []string
+	for _, key := range sort.keys {
+		if key.desc {
+			columns = append(columns, "-"+key.field.column)
+		} else {
+			columns = append(columns, key.field.column)
+		}
+	}
+	return columns
+}
+
+func TestParseProductSort(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"", []string{"id"}},
+		{"price", []string{"price", "id"}},
+		{"-price,productName", []string{"-price", "product_name", "id"}},
+		{"-id", []string{"-id"}},
+		{"brandName,-id", []string{"brand_name", "-id"}},
+	}
+
+	for _, test := range tests {
+		sort, err := parseProductSort(test.spec)
+		if err != nil {
+			t.Errorf("parseProductSort(%q) = %v", test.spec, err)
+			continue
+		}
+		if got := sortColumns(sort); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseProductSort(%q) sorts by %v, want %v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestParseProductSortRejectsUnknownFields(t *testing.T) {
+	for _, spec := range []string{
+		"user_id",
+		"product_name",
+		"price;DROP TABLE products",
+		"(SELECT password FROM users LIMIT 1)",
+		"price DESC",
+		"--price",
+		"price,",
+		"price,price",
+		"price,-price",
+	} {
+		if sort, err := parseProductSort(spec); err == nil {
+			t.Errorf("parseProductSort(%q) = %v, want an error", spec, sortColumns(sort))
+		}
+	}
+}
+
+// productSQL returns the SQL of a product query built by build
+func productSQL(t *testing.T, build func(*gorm.DB) *gorm.DB) string {
+	t.Helper()
+	dbtest.Use(t, func(string) ([]string, [][]driver.Value) { return nil, nil })
+
+	return db.DB.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return build(tx.Model(&models.Product{})).Find(&[]models.Product{})
+	})
+}
+
+func TestProductSortOrderAndAfter(t *testing.T) {
+	sort, err := parseProductSort("productName,-price")
+	if err != nil {
+		t.Fatal(err)
+	}
+	product := models.Product{ID: 5, ProductName: "Shoe", Price: 10}
+
+	tests := []struct {
+		name    string
+		before  bool
+		reverse bool
+		want    string
+	}{
+		{
+			name: "forward",
+			want: "SELECT * FROM `products` WHERE ((product_name > 'Shoe') OR (product_name = 'Shoe' AND price < 10) OR (product_name = 'Shoe' AND price = 10 AND id > 5)) AND `products`.`deleted_at` IS NULL ORDER BY product_name ASC,price DESC,id ASC",
+		},
+		{
+			name:    "backward",
+			before:  true,
+			reverse: true,
+			want:    "SELECT * FROM `products` WHERE ((product_name < 'Shoe') OR (product_name = 'Shoe' AND price > 10) OR (product_name = 'Shoe' AND price = 10 AND id < 5)) AND `products`.`deleted_at` IS NULL ORDER BY product_name DESC,price ASC,id DESC",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cursor, err := sort.decodeCursor(sort.cursorAt(product, test.before))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := productSQL(t, func(query *gorm.DB) *gorm.DB {
+				return sort.order(sort.after(query, cursor), test.reverse)
+			})
+			if got != test.want {
+				t.Errorf("query\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	sort, err := parseProductSort("-price,productName")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := sort.decodeCursor(sort.cursorAt(models.Product{ID: 5, ProductName: "Shoe", Price: 10}, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{int64(10), "Shoe", int64(5)}; !reflect.DeepEqual(cursor.Values, want) || !cursor.Before {
+		t.Errorf("decoded %+v, want values %v before a product", cursor, want)
+	}
+}
+
+func TestDecodeCursorRejectsMalformedCursors(t *testing.T) {
+	sort, err := parseProductSort("-price,productName")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := map[string]string{
+		"not base64":              "!!!",
+		"not JSON":                encode("price"),
+		"other sort order":        encode(`{"s":"price,productName","v":[10,"Shoe",5]}`),
+		"too few values":          encode(`{"s":"-price,productName","v":[10,"Shoe"]}`),
+		"too many values":         encode(`{"s":"-price,productName","v":[10,"Shoe",5,6]}`),
+		"string for a number":     encode(`{"s":"-price,productName","v":["10","Shoe",5]}`),
+		"number for a string":     encode(`{"s":"-price,productName","v":[10,7,5]}`),
+		"fraction":                encode(`{"s":"-price,productName","v":[10.5,"Shoe",5]}`),
+		"number out of range":     encode(`{"s":"-price,productName","v":[1e30,"Shoe",5]}`),
+		"null":                    encode(`{"s":"-price,productName","v":[null,"Shoe",5]}`),
+		"object":                  encode(`{"s":"-price,productName","v":[{"a":1},"Shoe",5]}`),
+		"SQL in a numeric column": encode(`{"s":"-price,productName","v":["1 OR 1=1","Shoe",5]}`),
+	}
+
+	for name, raw := range tests {
+		if cursor, err := sort.decodeCursor(raw); err != errInvalidCursor {
+			t.Errorf("%s: decodeCursor = %+v, %v, want errInvalidCursor", name, cursor, err)
+		}
+	}
+}
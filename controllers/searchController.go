@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/search"
+	"github.com/raihan1405/go-restapi/validators"
+)
+
+// ProductSearchHit is a matching product with its relevance and the matched
+// words of its fields wrapped in <mark> tags
+type ProductSearchHit struct {
+	Product    models.Product    `json:"product"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// ProductSearchResponse is one page of search results, best match first.
+// Facets count every matching product by category and brand.
+type ProductSearchResponse struct {
+	Query  string                    `json:"query"`
+	Hits   []ProductSearchHit        `json:"hits"`
+	Total  int                       `json:"total"`
+	Page   int                       `json:"page"`
+	Limit  int                       `json:"limit"`
+	Facets map[string]map[string]int `json:"facets"`
+}
+
+// SearchProducts godoc
+// @Summary Search products
+// @Description Full-text search over product names, brands and categories. Words are matched after stemming and with a few typos; the last word also matches as a prefix, so results can be shown while typing.
+// @Tags product
+// @Produce json
+// @Param q query string true "Search text; only its first 10 words are used"
+// @Param category query string false "Only products in this category or its subcategories, by name or slug"
+// @Param brand query string false "Only products of this brand"
+// @Param page query int false "Page number, from 1" default(1)
+// @Param limit query int false "Results per page, at most 100" default(20)
+// @Success 200 {object} ProductSearchResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/products/search [get]
+func SearchProducts(c *fiber.Ctx) error {
+	var params validators.ProductSearchQuery
+	if err := c.QueryParser(&params); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": "Invalid query parameters"})
+	}
+	if err := validators.Validate.Struct(params); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": err.Error()})
+	}
+	if params.Page == 0 {
+		params.Page = 1
+	}
+	if params.Limit == 0 {
+		params.Limit = 20
+	}
+
+	query := search.Query{
+		Text:    params.Q,
+		Filters: map[string][]string{},
+		Offset:  (params.Page - 1) * params.Limit,
+		Limit:   params.Limit,
+	}
+	// A category includes its subcategories, which the index knows by name
+	if params.Category != "" {
+		categories, err := categorySubtreeByName(params.Category)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot retrieve categories"})
+		}
+		names := []string{}
+		for _, category := range categories {
+			names = append(names, category.Name)
+		}
+		query.Filters[search.FacetCategory] = names
+	}
+	if params.Brand != "" {
+		query.Filters[search.FacetBrand] = []string{params.Brand}
+	}
+
+	result, err := search.Products.Search(query)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot search products"})
+	}
+
+	// The index only holds IDs and text, the products themselves come from the database
+	ids := make([]int, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		ids = append(ids, hit.ID)
+	}
+	var products []models.Product
+	if err := db.DB.Where("id IN ?", ids).Find(&products).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot retrieve products"})
+	}
+	byID := make(map[int]models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+
+	response := ProductSearchResponse{
+		Query:  params.Q,
+		Hits:   make([]ProductSearchHit, 0, len(result.Hits)),
+		Total:  result.Total,
+		Page:   params.Page,
+		Limit:  params.Limit,
+		Facets: result.Facets,
+	}
+	for _, hit := range result.Hits {
+		if product, ok := byID[hit.ID]; ok {
+			response.Hits = append(response.Hits, ProductSearchHit{Product: product, Score: hit.Score, Highlights: hit.Highlights})
+		}
+	}
+
+	return c.JSON(response)
+}
+
+// SuggestProducts godoc
+// @Summary Autocomplete search words
+// @Description Complete the start of a word to words that appear in the catalogue, most common first
+// @Tags product
+// @Produce json
+// @Param q query string true "Start of a word"
+// @Param limit query int false "Number of suggestions, at most 20" default(10)
+// @Success 200 {array} string
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/products/search/suggest [get]
+func SuggestProducts(c *fiber.Ctx) error {
+	prefix := c.Query("q")
+	if prefix == "" || len(prefix) > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(map[string]interface{}{"error": "q must be between 1 and 100 characters"})
+	}
+	limit := c.QueryInt("limit", 10)
+	if limit < 1 || limit > 20 {
+		limit = 10
+	}
+
+	suggestions, err := search.Products.Suggest(prefix, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(map[string]interface{}{"error": "Cannot suggest words"})
+	}
+
+	return c.JSON(suggestions)
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/audit"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+	"gorm.io/gorm"
+)
+
+// SessionResponse is a session of the authenticated user
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// RevokedSessionsResponse reports how many sessions were revoked
+type RevokedSessionsResponse struct {
+	Message string `json:"message"`
+	Revoked int64  `json:"revoked"`
+}
+
+// GetSessions godoc
+// @Summary List active sessions
+// @Description List the devices where the authenticated user is logged in
+// @Tags user
+// @Produce json
+// @Success 200 {array} SessionResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/user/sessions [get]
+func GetSessions(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	var sessions []models.Session
+	err := db.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", principal.UserID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot retrieve sessions", err.Error()})
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			Session: session,
+			Current: session.ID == principal.SessionID,
+		})
+	}
+
+	return c.JSON(response)
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session
+// @Description Log out one device of the authenticated user
+// @Tags user
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/user/sessions/{id} [delete]
+func RevokeSession(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	var session models.Session
+	err := db.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Params("id"), principal.UserID).First(&session).Error
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{"Session not found", "No active session with the given ID"})
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := auth.RevokeSession(tx, session.ID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{Action: "session.revoke", Target: sessionTarget(session.ID)})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot revoke session", err.Error()})
+	}
+
+	if session.ID == principal.SessionID {
+		clearSessionCookies(c)
+	}
+
+	return c.JSON(SuccessResponse{Message: "Session revoked"})
+}
+
+// RevokeOtherSessions godoc
+// @Summary Revoke all other sessions
+// @Description Log out every device of the authenticated user except the current one
+// @Tags user
+// @Produce json
+// @Success 200 {object} RevokedSessionsResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/user/sessions/revoke-others [post]
+func RevokeOtherSessions(c *fiber.Ctx) error {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{"unauthenticated", "Invalid or expired token"})
+	}
+
+	var revoked int64
+	err := db.DB.Transaction(func(tx *gorm.DB) (err error) {
+		if revoked, err = auth.RevokeUserSessions(tx, principal.UserID, principal.SessionID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, auditActor(c), audit.Event{
+			Action:  "session.revoke_others",
+			Target:  userTarget(principal.UserID),
+			Details: fiber.Map{"revokedSessions": revoked},
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot revoke sessions", err.Error()})
+	}
+
+	return c.JSON(RevokedSessionsResponse{Message: "Other sessions revoked", Revoked: revoked})
+}
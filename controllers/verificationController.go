@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/mailer"
+	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/validators"
+	"gorm.io/gorm"
+)
+
+// emailVerificationTTL is how long an email verification link stays valid
+const emailVerificationTTL = 48 * time.Hour
+
+// sendVerificationEmail issues a verification token for the user and mails it
+func sendVerificationEmail(user models.User) {
+	token, err := auth.IssueOneTimeToken(user.ID, models.TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		log.Printf("cannot issue verification token for user %d: %v", user.ID, err)
+		return
+	}
+
+	link := frontendURL("/verify-email", url.Values{"token": {token}})
+	err = mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+			user.Username, emailVerificationTTL, link),
+	})
+	if err != nil {
+		log.Printf("cannot send verification email to user %d: %v", user.ID, err)
+	}
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email address
+// @Description Confirm the email address of an account using the token from the verification email
+// @Tags auth
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/verify-email [get]
+func VerifyEmail(c *fiber.Ctx) error {
+	raw := c.Query("token")
+	if raw == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Missing token", "The token query parameter is required"})
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := auth.ConsumeOneTimeToken(tx, raw, models.TokenPurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ? AND verified_at IS NULL", token.UserID).
+			Update("verified_at", time.Now()).Error
+	})
+	if errors.Is(err, auth.ErrInvalidOneTimeToken) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Invalid verification token", err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{"Cannot verify email", err.Error()})
+	}
+
+	return c.JSON(SuccessResponse{Message: "Email address verified"})
+}
+
+// ResendVerificationEmail godoc
+// @Summary Resend the verification email
+// @Description Send a new verification link to an unverified account. The response is the same whether or not the email belongs to an account.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param resend body validators.ResendVerificationInput true "Account email"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/verify-email/resend [post]
+func ResendVerificationEmail(c *fiber.Ctx) error {
+	var data validators.ResendVerificationInput
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Cannot parse JSON", err.Error()})
+	}
+
+	if err := validators.Validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{"Validation error", err.Error()})
+	}
+
+	go func(email string) {
+		var user models.User
+		if err := db.DB.Where("email = ? AND verified_at IS NULL", email).First(&user).Error; err != nil {
+			return
+		}
+		sendVerificationEmail(user)
+	}(validators.NormalizeEmail(data.Email))
+
+	return c.JSON(SuccessResponse{Message: "If an unverified account exists for this email, a verification link has been sent"})
+}
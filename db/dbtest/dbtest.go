@@ -0,0 +1,123 @@
+// Package dbtest points db.DB at a fake database in tests. The fake records
+// every statement and answers queries with canned rows.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/raihan1405/go-restapi/db"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Respond returns the columns and rows a query is answered with
+type Respond func(query string) (columns []string, rows [][]driver.Value)
+
+// DB is a database/sql driver that records every statement and answers
+// queries with the rows returned by respond
+type DB struct {
+	mu         sync.Mutex
+	statements []string
+	args       [][]driver.Value
+	respond    Respond
+}
+
+// Use points db.DB at a fake database for the duration of the test
+func Use(t *testing.T, respond Respond) *DB {
+	t.Helper()
+
+	fake := &DB{respond: respond}
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{Conn: sql.OpenDB(fake), SkipInitializeWithVersion: true}),
+		&gorm.Config{DisableAutomaticPing: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := db.DB
+	db.DB = gormDB
+	t.Cleanup(func() { db.DB = previous })
+	return fake
+}
+
+// Executed returns the arguments of the first recorded statement starting
+// with prefix, and whether there was one
+func (f *DB) Executed(prefix string) ([]driver.Value, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, statement := range f.statements {
+		if strings.HasPrefix(statement, prefix) {
+			return f.args[i], true
+		}
+	}
+	return nil, false
+}
+
+func (f *DB) record(query string, args []driver.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statements = append(f.statements, query)
+	f.args = append(f.args, args)
+}
+
+func (f *DB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *DB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *DB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *DB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.record(s.query, args)
+	return fakeResult{}, nil
+}
+
+type fakeResult struct{}
+
+func (fakeResult) LastInsertId() (int64, error) { return 1, nil }
+func (fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.record(s.query, args)
+	columns, rows := s.db.respond(s.query)
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"errors"
+	"strings"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+// MySQL error numbers for unique and foreign key constraint violations
+const (
+	mysqlDuplicateEntry  = 1062
+	mysqlRowReferenced   = 1451
+	mysqlNoReferencedRow = 1452
+)
+
+// DuplicateKey reports whether err is a unique constraint violation and
+// returns the name of the violated index
+func DuplicateKey(err error) (string, bool) {
+	var mysqlErr *driver.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != mysqlDuplicateEntry {
+		return "", false
+	}
+
+	// Duplicate entry 'x' for key 'users.idx_users_email' (MySQL 8 prefixes the table)
+	message := strings.TrimSuffix(mysqlErr.Message, "'")
+	key := message[strings.LastIndex(message, "'")+1:]
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		key = key[i+1:]
+	}
+	return key, true
+}
+
+// RowReferenced reports whether err is a foreign key violation raised by
+// deleting a row other rows still refer to
+func RowReferenced(err error) bool {
+	return mysqlError(err, mysqlRowReferenced)
+}
+
+// NoReferencedRow reports whether err is a foreign key violation raised by
+// referring to a row that does not exist, for example one deleted meanwhile
+func NoReferencedRow(err error) bool {
+	return mysqlError(err, mysqlNoReferencedRow)
+}
+
+// mysqlError reports whether err is a MySQL error with the given number
+func mysqlError(err error, number uint16) bool {
+	var mysqlErr *driver.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == number
+}
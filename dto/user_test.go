@@ -0,0 +1,124 @@
+package dto_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/raihan1405/go-restapi/account"
+	"github.com/raihan1405/go-restapi/controllers"
+	"github.com/raihan1405/go-restapi/dto"
+	"github.com/raihan1405/go-restapi/models"
+)
+
+// secretMarker starts the value put into every secret-tagged field
+const secretMarker = "SECRET-"
+
+// fillSecrets sets every secret-tagged field reachable from v to a marker
+// naming the field, allocating nested structs on the way, and returns the
+// markers it set
+func fillSecrets(v reflect.Value, depth int) []string {
+	if depth > 4 {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return fillSecrets(v.Elem(), depth+1)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Struct && v.Type().Elem().Kind() != reflect.Pointer {
+			return nil
+		}
+		if v.Len() == 0 {
+			v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		}
+		return fillSecrets(v.Index(0), depth+1)
+	case reflect.Struct:
+	default:
+		return nil
+	}
+
+	var markers []string
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if field.Tag.Get("secret") != "true" {
+			markers = append(markers, fillSecrets(v.Field(i), depth+1)...)
+			continue
+		}
+
+		marker := secretMarker + v.Type().Name() + "." + field.Name
+		switch v.Field(i).Kind() {
+		case reflect.String:
+			v.Field(i).SetString(marker)
+		case reflect.Slice:
+			v.Field(i).SetBytes([]byte(marker))
+		default:
+			continue
+		}
+		markers = append(markers, marker)
+	}
+	return markers
+}
+
+// withSecrets returns a value of type T with all its secrets filled in
+func withSecrets[T any](t *testing.T) T {
+	t.Helper()
+
+	var value T
+	fillSecrets(reflect.ValueOf(&value).Elem(), 0)
+	return value
+}
+
+func TestFillSecretsFindsModelSecrets(t *testing.T) {
+	user := withSecrets[models.User](t)
+	if !strings.HasPrefix(string(user.Password), secretMarker) || !strings.HasPrefix(user.TOTPSecret, secretMarker) {
+		t.Fatal("the password hash and TOTP secret of models.User should be tagged secret")
+	}
+}
+
+func TestResponsesDoNotExposeSecrets(t *testing.T) {
+	user := withSecrets[models.User](t)
+	user.Roles = []models.Role{{ID: 1, Name: models.RoleAdmin}}
+
+	responses := map[string]interface{}{
+		"dto.User":                          dto.NewUser(user),
+		"dto.AdminUser":                     dto.NewAdminUser(user),
+		"dto.AdminUserDetail":               dto.AdminUserDetail{AdminUser: dto.NewAdminUser(user)},
+		"controllers.LoginResponse":         controllers.LoginResponse{User: dto.NewUser(user)},
+		"controllers.ImpersonationResponse": controllers.ImpersonationResponse{User: dto.NewUser(user)},
+		"account.Export":                    withSecrets[account.Export](t),
+		"models.Product":                    withSecrets[models.Product](t),
+		"models.CartItem":                   withSecrets[models.CartItem](t),
+		"models.Brand":                      withSecrets[models.Brand](t),
+		"models.Category":                   withSecrets[models.Category](t),
+		"models.Session":                    withSecrets[models.Session](t),
+		"models.APIKey":                     withSecrets[models.APIKey](t),
+		"models.UserIdentity":               withSecrets[models.UserIdentity](t),
+		"models.SigningKey":                 withSecrets[models.SigningKey](t),
+		"models.AuditEvent":                 withSecrets[models.AuditEvent](t),
+	}
+
+	for name, response := range responses {
+		body, err := json.Marshal(response)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		encoded := base64.StdEncoding.EncodeToString([]byte(secretMarker))[:8]
+		if strings.Contains(string(body), secretMarker) || strings.Contains(string(body), encoded) {
+			t.Errorf("%s exposes a secret-tagged field: %s", name, body)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package lockout
+
+import (
+	"errors"
+
+	"github.com/raihan1405/go-restapi/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBStore keeps entries in the login_attempts table so that all instances
+// share the same counters
+type DBStore struct {
+	db *gorm.DB
+}
+
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+func (s *DBStore) Get(key string) (Entry, error) {
+	var row models.LoginAttempt
+	err := s.db.Where("`key` = ?", key).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Entry{}, nil
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+	return entryFromRow(row), nil
+}
+
+func (s *DBStore) Update(key string, fn func(*Entry)) (Entry, error) {
+	var entry Entry
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Make sure the row exists, then lock it for the read-modify-write
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginAttempt{Key: key}).Error
+		if err != nil {
+			return err
+		}
+
+		var row models.LoginAttempt
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("`key` = ?", key).First(&row).Error
+		if err != nil {
+			return err
+		}
+
+		entry = entryFromRow(row)
+		fn(&entry)
+
+		row.Failures = entry.Failures
+		row.LastFailureAt = &entry.LastFailure
+		row.LockedUntil = &entry.LockedUntil
+		return tx.Save(&row).Error
+	})
+	return entry, err
+}
+
+func (s *DBStore) Delete(key string) error {
+	return s.db.Where("`key` = ?", key).Delete(&models.LoginAttempt{}).Error
+}
+
+func entryFromRow(row models.LoginAttempt) Entry {
+	entry := Entry{Failures: row.Failures}
+	if row.LastFailureAt != nil {
+		entry.LastFailure = *row.LastFailureAt
+	}
+	if row.LockedUntil != nil {
+		entry.LockedUntil = *row.LockedUntil
+	}
+	return entry
+}
@@ -0,0 +1,59 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps entries in process memory. Counters are lost on restart
+// and are not shared between instances; use DBStore for that.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	swept   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry)}
+}
+
+func (s *MemoryStore) Get(key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key], nil
+}
+
+func (s *MemoryStore) Update(key string, fn func(*Entry)) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep()
+
+	entry := s.entries[key]
+	fn(&entry)
+	s.entries[key] = entry
+	return entry, nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep drops entries that have been quiet for a day so the map does not grow
+// without bound. It runs at most once a minute.
+func (s *MemoryStore) sweep() {
+	now := time.Now()
+	if now.Sub(s.swept) < time.Minute {
+		return
+	}
+	s.swept = now
+
+	for key, entry := range s.entries {
+		if now.Sub(entry.LastFailure) > 24*time.Hour && now.After(entry.LockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
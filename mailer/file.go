@@ -0,0 +1,27 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer writes every message as an .eml file into Dir instead of sending
+// it, which stands in for an SMTP server during local development
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+var fileSeq uint64
+
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%d.eml", time.Now().Format("20060102T150405.000000000"), atomic.AddUint64(&fileSeq, 1))
+	return os.WriteFile(filepath.Join(m.Dir, name), render(m.From, msg), 0o600)
+}
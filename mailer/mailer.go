@@ -0,0 +1,85 @@
+// Package mailer sends transactional email such as password reset links.
+// The implementation is chosen with MAIL_DRIVER so that development and
+// tests can run without an SMTP server.
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Default is the mailer used by the application, set by Init
+var Default Mailer = NewMemoryMailer()
+
+// Init selects the mailer from the environment:
+//
+//	MAIL_DRIVER=smtp    SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD
+//	MAIL_DRIVER=file    writes .eml files to MAIL_DIR (default "mail")
+//	MAIL_DRIVER=memory  keeps messages in memory
+//
+// MAIL_FROM sets the sender address. The file driver is the default.
+func Init() {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		Default = &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	case "memory":
+		Default = NewMemoryMailer()
+	case "", "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		Default = &FileMailer{Dir: dir, From: from}
+	default:
+		log.Fatalf("unknown MAIL_DRIVER %q", driver)
+	}
+}
+
+// Send delivers the message with the default mailer
+func Send(msg Message) error {
+	return Default.Send(msg)
+}
+
+// render formats the message as an RFC 5322 email
+func render(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(msg.Body)
+	return buf.Bytes()
+}
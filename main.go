@@ -7,12 +7,22 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/gofiber/fiber/v2/utils"
 	"github.com/gofiber/swagger"
 	"github.com/joho/godotenv"
+	"github.com/raihan1405/go-restapi/account"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/controllers"
 	"github.com/raihan1405/go-restapi/db"
 	_ "github.com/raihan1405/go-restapi/docs"
+	"github.com/raihan1405/go-restapi/lockout"
+	"github.com/raihan1405/go-restapi/mailer"
 	"github.com/raihan1405/go-restapi/models"
+	"github.com/raihan1405/go-restapi/oidc"
+	"github.com/raihan1405/go-restapi/passwords"
 	"github.com/raihan1405/go-restapi/routes"
+	"github.com/raihan1405/go-restapi/search"
 )
 
 func getPort() string {
@@ -54,8 +64,20 @@ func main() {
 		AllowHeaders:     "Origin,Content-Type,Accept,Authorization",
 	}))
 
+	// Setiap request mendapat ID (atau memakai X-Request-ID dari client) yang dicatat di audit log
+	app.Use(requestid.New(requestid.Config{Generator: utils.UUIDv4}))
+
 	db.Init()
 	models.Setup(db.DB)
+	auth.InitKeys()
+	mailer.Init()
+	lockout.Init()
+	passwords.Init()
+	search.Init()
+	account.StartPurger()
+	if err := oidc.Init(controllers.OIDCRedirectURL); err != nil {
+		log.Fatal("Error loading OIDC providers: ", err)
+	}
 	routes.Setup(app)
 
 	app.Get("/swagger/*", swagger.HandlerDefault) // default
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jwtware "github.com/gofiber/jwt/v3"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+)
+
+// Authenticate accepts either an API key in "Authorization: Bearer <key>" or
+// the access token in the jwt cookie. For tokens it checks that the session
+// has not been revoked. Tokens are verified with the key named by their kid
+// header, see auth.KeyManager. It loads the user the credential belongs to and stores
+// an auth.Principal on the request context.
+// Handlers behind it read the caller through auth.GetPrincipal.
+func Authenticate() fiber.Handler {
+	verifyToken := jwtware.New(jwtware.Config{
+		KeyFunc:        auth.Keys.Keyfunc,
+		TokenLookup:    "cookie:jwt",
+		Claims:         &auth.Claims{},
+		SuccessHandler: loadPrincipal,
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			return unauthorized(c, "Invalid or expired token")
+		},
+	})
+
+	return func(c *fiber.Ctx) error {
+		if key, ok := bearerAPIKey(c); ok {
+			return loadAPIKeyPrincipal(c, key)
+		}
+		return verifyToken(c)
+	}
+}
+
+// bearerAPIKey returns the API key from the Authorization header, if there is one
+func bearerAPIKey(c *fiber.Ctx) (string, bool) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+
+	key := strings.TrimSpace(header[7:])
+	return key, auth.IsAPIKey(key)
+}
+
+// loadAPIKeyPrincipal authenticates the request as the owner of the API key
+func loadAPIKeyPrincipal(c *fiber.Ctx, key string) error {
+	apiKey, err := auth.VerifyAPIKey(key)
+	if err != nil {
+		return unauthorized(c, err.Error())
+	}
+
+	var user models.User
+	if err := db.DB.Preload("Roles").First(&user, apiKey.UserID).Error; err != nil {
+		return unauthorized(c, "No user with the given ID")
+	}
+	if user.IsDisabled() {
+		return unauthorized(c, "Account has been disabled")
+	}
+
+	auth.SetPrincipal(c, &auth.Principal{
+		UserID:   user.ID,
+		Roles:    user.RoleNames(),
+		APIKeyID: apiKey.ID,
+		Scopes:   apiKey.ScopeList(),
+	})
+
+	return c.Next()
+}
+
+// RequireSession rejects requests authenticated with an API key. It protects
+// credential management, which must not be reachable with a leaked key.
+// It must run after Authenticate.
+func RequireSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := auth.GetPrincipal(c)
+		if !ok {
+			return unauthorized(c, "Invalid or expired token")
+		}
+
+		if principal.ViaAPIKey() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "forbidden",
+				"error":   "This endpoint cannot be used with an API key",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// ForbidImpersonation rejects requests made in an impersonation session. It
+// protects operations only the account owner may perform, such as changing
+// credentials or deleting the account. It must run after Authenticate.
+func ForbidImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := auth.GetPrincipal(c)
+		if !ok {
+			return unauthorized(c, "Invalid or expired token")
+		}
+
+		if principal.Impersonating() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "forbidden",
+				"error":   "This endpoint cannot be used while impersonating a user",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// loadPrincipal runs after the token has been verified
+func loadPrincipal(c *fiber.Ctx) error {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return unauthorized(c, "Invalid token")
+	}
+
+	claims, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		return unauthorized(c, "Invalid token claims")
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return unauthorized(c, "Token contains invalid user ID")
+	}
+
+	var user models.User
+	if err := db.DB.Preload("Roles").First(&user, userID).Error; err != nil {
+		return unauthorized(c, "No user with the given ID")
+	}
+	if user.IsDisabled() {
+		return unauthorized(c, "Account has been disabled")
+	}
+
+	// The token is only as good as the session it was issued for
+	var session models.Session
+	if err := db.DB.Where("id = ? AND user_id = ?", claims.ID, user.ID).First(&session).Error; err != nil || !session.Active() {
+		return unauthorized(c, "Session has been revoked or has expired")
+	}
+
+	// The act claim has to match the session, and the admin has to still be allowed in
+	principal := &auth.Principal{
+		UserID:    user.ID,
+		Roles:     user.RoleNames(),
+		SessionID: claims.ID,
+	}
+	if session.Impersonated() || claims.Actor != nil {
+		if !session.Impersonated() || claims.Actor == nil || claims.Actor.Subject != strconv.Itoa(*session.ImpersonatorID) {
+			return unauthorized(c, "Token does not match its session")
+		}
+
+		var impersonator models.User
+		if err := db.DB.First(&impersonator, *session.ImpersonatorID).Error; err != nil || impersonator.IsDisabled() {
+			return unauthorized(c, "Impersonating admin is no longer active")
+		}
+		principal.ImpersonatorID = impersonator.ID
+	}
+
+	// Track activity for the session list, at most once per minute
+	if now := time.Now(); now.Sub(session.LastSeenAt) > time.Minute {
+		db.DB.Model(&session).Updates(map[string]interface{}{
+			"last_seen_at": now,
+			"ip_address":   c.IP(),
+		})
+	}
+
+	auth.SetPrincipal(c, principal)
+
+	return c.Next()
+}
+
+func unauthorized(c *fiber.Ctx, reason string) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated", "error": reason})
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/auth"
+)
+
+// RequirePermission only lets the request through when the authenticated
+// principal has the given permission. It must run after Authenticate.
+func RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := auth.GetPrincipal(c)
+		if !ok {
+			return unauthorized(c, "Invalid or expired token")
+		}
+
+		if !principal.Can(permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "forbidden",
+				"error":   "Missing permission " + permission,
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/raihan1405/go-restapi/auth"
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+)
+
+// RequireVerifiedEmail blocks the request when EMAIL_VERIFICATION_POLICY
+// requires a verified email for the action and the principal's email has not
+// been verified. It must run after Authenticate.
+func RequireVerifiedEmail(action string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !auth.VerificationRequiredFor(action) {
+			return c.Next()
+		}
+
+		principal, ok := auth.GetPrincipal(c)
+		if !ok {
+			return unauthorized(c, "Invalid or expired token")
+		}
+
+		var user models.User
+		if err := db.DB.Select("id", "verified_at").First(&user, principal.UserID).Error; err != nil {
+			return unauthorized(c, "No user with the given ID")
+		}
+
+		if !user.IsVerified() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "Email not verified",
+				"error":   "Confirm your email address before you " + action,
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey is a personal key for server-to-server clients, sent as
+// "Authorization: Bearer <key>". Only the SHA-256 hash of the key is stored;
+// Prefix is the visible part that identifies the key in listings.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"userId" gorm:"not null;index"`
+	User       User       `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Name       string     `json:"name" gorm:"size:100;not null"`
+	Prefix     string     `json:"prefix" gorm:"size:16;not null;uniqueIndex"`
+	KeyHash    string     `json:"-" gorm:"size:64;not null" secret:"true"`
+	Scopes     string     `json:"-" gorm:"size:255"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+// ScopeList returns the scopes the key is limited to, or nil if it has the
+// full permissions of its user
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// Active reports whether the key can still be used
+func (k *APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
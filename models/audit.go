@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAuditEventImmutable is returned when code tries to change or remove an audit event
+var ErrAuditEventImmutable = errors.New("audit events are append-only")
+
+// AuditEvent records who did what to which object. Rows are only ever
+// inserted, except that audit.Anonymize removes the personal data of purged
+// users from them. The actor is kept as a plain ID, without a foreign key, so that
+// events outlive purged accounts. ImpersonatorID is the admin who acted as
+// ActorID, if any.
+type AuditEvent struct {
+	ID             int64           `json:"id"`
+	ActorID        *int            `json:"actorId" gorm:"index"`
+	ImpersonatorID *int            `json:"impersonatorId,omitempty" gorm:"index"`
+	Action         string          `json:"action" gorm:"size:64;not null;index"`
+	TargetType     string          `json:"targetType" gorm:"size:32;not null;index:idx_audit_events_target"`
+	TargetID       string          `json:"targetId" gorm:"size:64;index:idx_audit_events_target"`
+	Before         json.RawMessage `json:"before" gorm:"type:json" swaggertype:"object"`
+	After          json.RawMessage `json:"after" gorm:"type:json" swaggertype:"object"`
+	Details        json.RawMessage `json:"details" gorm:"type:json" swaggertype:"object"`
+	IPAddress      string          `json:"ipAddress" gorm:"size:45"`
+	UserAgent      string          `json:"userAgent" gorm:"size:255"`
+	RequestID      string          `json:"requestId" gorm:"size:64;index"`
+	CreatedAt      time.Time       `json:"createdAt" gorm:"index"`
+}
+
+// BeforeUpdate keeps audit events from being changed through GORM
+func (e *AuditEvent) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+// BeforeDelete keeps audit events from being removed through GORM
+func (e *AuditEvent) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
+}
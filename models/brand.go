@@ -0,0 +1,58 @@
+package models
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Brand has a page of its own. The seller who created it manages it; brands
+// taken over from the old free-text brand names have no owner and are
+// managed by admins.
+type Brand struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name" gorm:"size:100;not null"`
+	Slug        string    `json:"slug" gorm:"size:100;not null;uniqueIndex:idx_brands_slug"`
+	LogoURL     string    `json:"logoUrl" gorm:"size:512"`
+	Description string    `json:"description" gorm:"type:text"`
+	OwnerID     *int      `json:"ownerId" gorm:"index"`
+	Owner       *User     `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// backfillBrands turns the free-text brand names of existing products into
+// brand rows, merging names with the same slug. Products added since always
+// carry a brand ID, so after the first run there is nothing left to do.
+func backfillBrands(db *gorm.DB) {
+	var names []string
+	err := db.Model(&Product{}).Unscoped().
+		Where("brand_id IS NULL AND brand_name <> ''").
+		Distinct().Order("brand_name").Pluck("brand_name", &names).Error
+	if err != nil {
+		log.Printf("cannot backfill brands: %v", err)
+		return
+	}
+
+	for _, name := range names {
+		slug := Slugify(name)
+		if slug == "" {
+			continue
+		}
+
+		brand := Brand{Name: strings.TrimSpace(name), Slug: slug}
+		if err := db.Where("slug = ?", slug).FirstOrCreate(&brand).Error; err != nil {
+			log.Printf("cannot backfill brand %q: %v", name, err)
+			continue
+		}
+
+		err := db.Model(&Product{}).Unscoped().
+			Where("brand_id IS NULL AND brand_name = ?", name).
+			Updates(map[string]interface{}{"brand_id": brand.ID, "brand_name": brand.Name}).Error
+		if err != nil {
+			log.Printf("cannot backfill brand %q: %v", name, err)
+		}
+	}
+}
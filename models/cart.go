@@ -1,8 +1,12 @@
 package models
 
+// CartItem is a single line in a user's cart. Each user has at most one line
+// per product; adding the same product again increases the quantity.
 type CartItem struct {
-	ID        int    `json:"id"`
-	ProductID int    `json:"productId"`
-	UserID    string `json:"userId"`
-	Quantity  int    `json:"quantity"`
+	ID        int     `json:"id"`
+	UserID    int     `json:"userId" gorm:"not null;uniqueIndex:idx_cart_items_user_product"`
+	ProductID int     `json:"productId" gorm:"not null;uniqueIndex:idx_cart_items_user_product"`
+	Quantity  int     `json:"quantity" gorm:"not null"`
+	User      User    `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Product   Product `json:"product" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 }
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Category is a node of the product taxonomy. Top-level categories have no
+// parent; siblings are shown by Position, then name.
+type Category struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name" gorm:"size:100;not null"`
+	Slug      string    `json:"slug" gorm:"size:100;not null;uniqueIndex:idx_categories_slug"`
+	ParentID  *int      `json:"parentId" gorm:"index"`
+	Parent    *Category `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	Position  int       `json:"position" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Slugify turns a name into a URL-friendly slug: lowercase letters and
+// digits separated by single dashes
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// migrateCategories turns the free-text categories of existing products into
+// category rows. Spellings with the same slug, such as "Shoes" and " shoes",
+// become one category named after the first spelling found. Products that
+// already have a category ID are left alone, so this runs on every start.
+func migrateCategories(db *gorm.DB) {
+	var names []string
+	err := db.Model(&Product{}).Unscoped().
+		Where("category_id IS NULL AND category <> ''").
+		Distinct().Order("category").Pluck("category", &names).Error
+	if err != nil {
+		log.Printf("cannot migrate product categories: %v", err)
+		return
+	}
+
+	for _, name := range names {
+		slug := Slugify(name)
+		if slug == "" {
+			continue
+		}
+
+		category := Category{Name: strings.TrimSpace(name), Slug: slug}
+		if err := db.Where("slug = ?", slug).FirstOrCreate(&category).Error; err != nil {
+			log.Printf("cannot migrate product category %q: %v", name, err)
+			continue
+		}
+
+		err := db.Model(&Product{}).Unscoped().
+			Where("category_id IS NULL AND category = ?", name).
+			Updates(map[string]interface{}{"category_id": category.ID, "category": category.Name}).Error
+		if err != nil {
+			log.Printf("cannot migrate product category %q: %v", name, err)
+		}
+	}
+}
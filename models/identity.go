@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// UserIdentity links an account at an external OpenID Connect provider to a user
+type UserIdentity struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"userId" gorm:"not null;index"`
+	User        User       `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Provider    string     `json:"provider" gorm:"size:32;not null;uniqueIndex:idx_identity_provider_subject"`
+	Subject     string     `json:"-" gorm:"size:191;not null;uniqueIndex:idx_identity_provider_subject"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+}
+
+// OIDCLogin is a login with an external provider that has been started but
+// not completed yet. It is deleted when the provider redirects back.
+type OIDCLogin struct {
+	StateHash    string    `json:"-" gorm:"primaryKey;size:64" secret:"true"`
+	Provider     string    `json:"provider" gorm:"size:32;not null"`
+	Nonce        string    `json:"-" gorm:"size:64;not null" secret:"true"`
+	CodeVerifier string    `json:"-" gorm:"size:64;not null" secret:"true"`
+	CreatedAt    time.Time `json:"createdAt"`
+	ExpiresAt    time.Time `json:"expiresAt" gorm:"index"`
+}
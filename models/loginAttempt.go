@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginAttempt holds the failed login counter of one account or IP for the
+// database lockout store. Key is namespaced, e.g. "account:alice@example.com".
+type LoginAttempt struct {
+	Key           string `gorm:"primaryKey;size:191"`
+	Failures      int    `gorm:"not null;default:0"`
+	LastFailureAt *time.Time
+	LockedUntil   *time.Time
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// RecoveryCode is a one-time code that can be used instead of a TOTP code
+// when the authenticator is lost. Only the SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userId" gorm:"not null;index"`
+	User      User       `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null;index" secret:"true"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+}
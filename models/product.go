@@ -1,13 +1,27 @@
 package models
 
+import "gorm.io/gorm"
 
+// Product yang dihapus hanya ditandai dengan DeletedAt, sehingga tidak muncul
+// lagi di katalog tetapi tetap bisa dirujuk oleh keranjang yang sudah ada.
 type Product struct{
 	ID int    `json:"id"`
 	ProductName string `json:"productName"`
+	// BrandName is the name of the brand, kept in step with BrandID
 	BrandName string `json:"brandName"`
+	BrandID   *int   `json:"brandId" gorm:"index"`
+	// BrandRecord only exists for the foreign key, which stops a brand from
+	// being deleted while products still use it
+	BrandRecord *Brand `json:"-" gorm:"foreignKey:BrandID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
 	Price int `json:"price"`
 	Status bool `json:"status"`
 	Quantity int `json:"quantity"`
-	Category    string `json:"Category"`
+	// Category is the name of the category, kept in step with CategoryID
+	Category    string `json:"category"`
+	CategoryID  *int   `json:"categoryId" gorm:"index"`
+	// CategoryRecord only exists for the foreign key, which stops a category
+	// from being deleted while products still use it
+	CategoryRecord *Category `json:"-" gorm:"foreignKey:CategoryID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
 	UserID      string `json:"userId"`
+	DeletedAt   gorm.DeletedAt `json:"deletedAt" gorm:"index" swaggertype:"string" format:"date-time"`
 }
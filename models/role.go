@@ -0,0 +1,52 @@
+package models
+
+import (
+	"log"
+	"os"
+
+	"gorm.io/gorm"
+)
+
+// Nama role yang dikenal aplikasi
+const (
+	RoleAdmin    = "admin"
+	RoleSeller   = "seller"
+	RoleCustomer = "customer"
+)
+
+// RoleNames lists every role that can be granted to a user
+var RoleNames = []string{RoleAdmin, RoleSeller, RoleCustomer}
+
+type Role struct {
+	ID   int    `json:"id"`
+	Name string `json:"name" gorm:"size:50;not null;uniqueIndex"`
+}
+
+// seedRoles makes sure every known role exists and, when ADMIN_EMAIL is set,
+// that the user with that email is an admin so the first admin can be bootstrapped.
+func seedRoles(db *gorm.DB) {
+	for _, name := range RoleNames {
+		if err := db.FirstOrCreate(&Role{}, Role{Name: name}).Error; err != nil {
+			log.Printf("cannot seed role %q: %v", name, err)
+		}
+	}
+
+	email := os.Getenv("ADMIN_EMAIL")
+	if email == "" {
+		return
+	}
+
+	var user User
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		return
+	}
+
+	var admin Role
+	if err := db.Where("name = ?", RoleAdmin).First(&admin).Error; err != nil {
+		return
+	}
+
+	if err := db.Model(&user).Association("Roles").Append(&admin); err != nil {
+		log.Printf("cannot grant admin role to %s: %v", email, err)
+	}
+}
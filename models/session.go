@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Session is a login on one device. Every refresh token issued for the login
+// belongs to the same session, so revoking the session revokes the whole
+// refresh token family.
+type Session struct {
+	ID         string     `json:"id" gorm:"primaryKey;size:32"`
+	UserID     int        `json:"userId" gorm:"not null;index"`
+	User       User       `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserAgent  string     `json:"userAgent" gorm:"size:255"`
+	IPAddress  string     `json:"ipAddress" gorm:"size:45"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	// ImpersonatorID is the admin who opened the session to act as the user
+	ImpersonatorID *int `json:"impersonatorId,omitempty" gorm:"index"`
+}
+
+// Active reports whether the session can still be used
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// Impersonated reports whether an admin opened the session on behalf of the user
+func (s *Session) Impersonated() bool {
+	return s.ImpersonatorID != nil
+}
+
+// RefreshToken is one refresh token in a session's rotation chain.
+// Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	ID        int        `json:"id"`
+	SessionID string     `json:"sessionId" gorm:"size:32;not null;index"`
+	Session   Session    `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	TokenHash string     `json:"-" gorm:"size:64;not null;uniqueIndex" secret:"true"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+}
@@ -1,10 +1,72 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
 
 func Setup(db *gorm.DB) {
-	db.AutoMigrate(
+	// Emails are stored case-folded; fold existing rows before the unique index is added
+	if db.Migrator().HasTable(&User{}) {
+		db.Exec("UPDATE users SET email = LOWER(TRIM(email))")
+	}
+
+	err := db.AutoMigrate(
+		&Role{},
 		&User{},
+		&Category{},
+		&Brand{},
 		&Product{},
+		&CartItem{},
+		&Session{},
+		&RefreshToken{},
+		&OneTimeToken{},
+		&RecoveryCode{},
+		&LoginAttempt{},
+		&APIKey{},
+		&SigningKey{},
+		&UserIdentity{},
+		&OIDCLogin{},
+		&AuditEvent{},
 	)
+	if err != nil {
+		// Most likely duplicate emails or usernames that block the unique
+		// indexes. Tables after the failing one are not migrated, so the
+		// server must not start until the rows are fixed.
+		logDuplicates(db, "users", "email")
+		logDuplicates(db, "users", "username")
+		logDuplicates(db, "categories", "slug")
+		logDuplicates(db, "brands", "slug")
+		log.Fatalf("auto migration failed: %v", err)
+	}
+
+	seedRoles(db)
+	migrateCategories(db)
+	backfillBrands(db)
+}
+
+// logDuplicates prints the rows sharing a value of a column that is meant to
+// be unique, so they can be fixed by hand
+func logDuplicates(db *gorm.DB, table, column string) {
+	if !db.Migrator().HasColumn(table, column) {
+		return
+	}
+
+	var duplicates []struct {
+		Value string `gorm:"column:value"`
+		IDs   string `gorm:"column:ids"`
+	}
+	err := db.Table(table).
+		Select(column + " AS value, GROUP_CONCAT(id ORDER BY id) AS ids").
+		Group(column).Having("COUNT(*) > 1").
+		Scan(&duplicates).Error
+	if err != nil {
+		log.Printf("cannot look for duplicate %s.%s: %v", table, column, err)
+		return
+	}
+
+	for _, duplicate := range duplicates {
+		log.Printf("duplicate %s.%s %q in rows with id %s", table, column, duplicate.Value, duplicate.IDs)
+	}
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// SigningKey is a key pair used to sign access tokens. The newest key without
+// RetiredAt signs new tokens; retired keys keep verifying tokens until
+// ExpiresAt so that rotation does not log anyone out. PrivateKey is stored
+// encrypted with a key from the environment, see auth.KeyEncryptionKeyFromEnv.
+type SigningKey struct {
+	Kid        string     `json:"kid" gorm:"primaryKey;size:32"`
+	Algorithm  string     `json:"algorithm" gorm:"size:16;not null"`
+	PrivateKey string     `json:"-" gorm:"type:text;not null" secret:"true"`
+	PublicKey  string     `json:"publicKey" gorm:"type:text;not null"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	RetiredAt  *time.Time `json:"retiredAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Purposes of one-time tokens
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeMFAChallenge      = "mfa_challenge"
+	TokenPurposeMagicLink         = "magic_link"
+)
+
+// OneTimeToken is a single-use, expiring token sent to a user by email.
+// Only the SHA-256 hash of the token is stored.
+type OneTimeToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userId" gorm:"not null;index"`
+	User      User       `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Purpose   string     `json:"purpose" gorm:"size:32;not null;index"`
+	TokenHash string     `json:"-" gorm:"size:64;not null;uniqueIndex" secret:"true"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	// Attempts counts failed uses of tokens that allow retries, such as MFA challenges
+	Attempts int `json:"attempts" gorm:"not null;default:0"`
+}
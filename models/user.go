@@ -1,11 +1,51 @@
 package models
 
+import "time"
+
 type User struct {
+	ID          int        `json:"id"`
+	Email       string     `json:"email" validate:"required,email" gorm:"size:191;not null;uniqueIndex:idx_users_email"`
+	PhoneNumber string     `json:"phoneNumber" validate:"required" gorm:"size:32"`
+	Username    string     `json:"username" validate:"required" gorm:"size:191;not null;uniqueIndex:idx_users_username"`
+	Password    []byte     `json:"-" validate:"required" secret:"true"`
+	Roles       []Role     `json:"roles" gorm:"many2many:user_roles;"`
+	VerifiedAt  *time.Time `json:"verifiedAt"`
+
+	// TOTP two-factor authentication. TOTPPendingSecret holds a secret that
+	// has been generated but not yet confirmed with a first code.
+	TOTPSecret        string     `json:"-" gorm:"size:64" secret:"true"`
+	TOTPPendingSecret string     `json:"-" gorm:"size:64" secret:"true"`
+	TOTPLastStep      int64      `json:"-"`
+	MFAEnabledAt      *time.Time `json:"mfaEnabledAt"`
+
+	// DisabledAt is set while an admin has disabled the account
+	DisabledAt *time.Time `json:"disabledAt"`
+
+	// DeletionScheduledAt is when the account will be purged after the user
+	// deleted it. Logging in again before then keeps the account.
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt" gorm:"index"`
+}
+
+// RoleNames returns the names of the roles loaded on the user
+func (u *User) RoleNames() []string {
+	names := make([]string, 0, len(u.Roles))
+	for _, role := range u.Roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
+
+// IsVerified reports whether the user has confirmed their email address
+func (u *User) IsVerified() bool {
+	return u.VerifiedAt != nil
+}
+
+// IsDisabled reports whether an admin has disabled the account
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
 
-	ID          int    `json:"id"`
-	Email       string `json:"email" validate:"required,email"`
-	PhoneNumber string `json:"phoneNumber" validate:"required"`
-	Username    string `json:"username" validate:"required"`
-	Password    []byte `json:"password" validate:"required"`
-	
+// MFAEnabled reports whether the user has confirmed TOTP two-factor authentication
+func (u *User) MFAEnabled() bool {
+	return u.MFAEnabledAt != nil && u.TOTPSecret != ""
 }
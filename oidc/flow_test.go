@@ -0,0 +1,413 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const testClientID = "test-client"
+
+// mockIssuer is a local OpenID Connect provider serving discovery, an
+// authorization endpoint that approves every request, a token endpoint
+// that checks PKCE, and a JWKS with a key that can be rotated
+type mockIssuer struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	kid        string
+	key        *rsa.PrivateKey
+	jwksHits   int
+	codes      map[string]pendingCode
+	nextCode   int
+	email      string
+	emailValid bool
+}
+
+// pendingCode is an authorization code waiting to be redeemed
+type pendingCode struct {
+	challenge string
+	nonce     string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	m := &mockIssuer{codes: map[string]pendingCode{}, email: "buyer@example.com", emailValid: true}
+	m.rotate(t, "key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.jwksHits++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": m.kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("client_id") != testClientID || query.Get("code_challenge_method") != "S256" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		m.mu.Lock()
+		m.nextCode++
+		code := "code-" + strconv.Itoa(m.nextCode)
+		m.codes[code] = pendingCode{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+		m.mu.Unlock()
+
+		redirect := query.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		m.mu.Lock()
+		pending, ok := m.codes[r.PostForm.Get("code")]
+		delete(m.codes, r.PostForm.Get("code"))
+		m.mu.Unlock()
+
+		if !ok || codeChallenge(r.PostForm.Get("code_verifier")) != pending.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     m.sign(t, m.claims(pending.nonce)),
+		})
+	})
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// rotate replaces the signing key with a new one under the kid
+func (m *mockIssuer) rotate(t *testing.T, kid string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kid, m.key = kid, key
+}
+
+// fetches returns how often the key set has been fetched
+func (m *mockIssuer) fetches() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.jwksHits
+}
+
+// claims returns valid ID token claims for the client with the nonce
+func (m *mockIssuer) claims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            m.URL,
+		"aud":            testClientID,
+		"sub":            "subject-1",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          m.email,
+		"email_verified": m.emailValid,
+	}
+}
+
+// sign signs the claims with the current key
+func (m *mockIssuer) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = m.kid
+	raw, err := token.SignedString(m.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func (m *mockIssuer) provider() *Provider {
+	return &Provider{
+		Name:        "mock",
+		Issuer:      m.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://shop.example.com/login/oidc/mock/callback",
+		HTTPClient:  m.Client(),
+	}
+}
+
+// authorize sends the user to the authorization URL and returns the code and
+// state the provider redirects back with
+func (m *mockIssuer) authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+
+	client := *m.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization failed: %s %v", resp.Status, err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// RFC 7636 appendix B
+	got := codeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Fatalf("codeChallenge = %q, want %q", got, want)
+	}
+}
+
+func TestNewAuthRequest(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+
+	first, err := provider.NewAuthRequest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := provider.NewAuthRequest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.State == second.State || first.Nonce == second.Nonce || first.CodeVerifier == second.CodeVerifier {
+		t.Error("every request should get a fresh state, nonce and verifier")
+	}
+	// RFC 7636 section 4.1: 43 to 128 characters
+	if n := len(first.CodeVerifier); n < 43 || n > 128 {
+		t.Errorf("code verifier has %d characters", n)
+	}
+
+	authURL, err := url.Parse(first.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authURL.Query()
+	if !strings.HasPrefix(first.URL, issuer.URL+"/authorize?") {
+		t.Errorf("URL %q does not use the discovered authorization endpoint", first.URL)
+	}
+	if query.Get("code_challenge") != codeChallenge(first.CodeVerifier) || query.Get("code_challenge_method") != "S256" {
+		t.Error("URL does not carry the S256 challenge of the verifier")
+	}
+	if query.Get("state") != first.State || query.Get("nonce") != first.Nonce {
+		t.Error("URL does not carry the state and nonce")
+	}
+	if query.Get("code_verifier") != "" {
+		t.Error("the verifier must not leave the server")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	request, err := provider.NewAuthRequest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := issuer.authorize(t, request.URL)
+	if state != request.State {
+		t.Fatalf("provider returned state %q, want %q", state, request.State)
+	}
+
+	identity, err := provider.Exchange(ctx, code, request.CodeVerifier, request.Nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Provider != "mock" || identity.Subject != "subject-1" || identity.Email != issuer.email || !identity.EmailVerified {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	// A code can only be redeemed once
+	if _, err := provider.Exchange(ctx, code, request.CodeVerifier, request.Nonce); err == nil {
+		t.Error("redeeming a code twice should fail")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	request, err := provider.NewAuthRequest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := provider.NewAuthRequest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := issuer.authorize(t, request.URL)
+	if _, err := provider.Exchange(ctx, code, other.CodeVerifier, request.Nonce); err == nil {
+		t.Fatal("a code redeemed with another request's verifier should fail")
+	}
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	request, err := provider.NewAuthRequest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := provider.NewAuthRequest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := issuer.authorize(t, request.URL)
+	_, err = provider.Exchange(ctx, code, request.CodeVerifier, other.Nonce)
+	if !errors.Is(err, ErrInvalidIDToken) || !strings.Contains(err.Error(), "nonce") {
+		t.Fatalf("Exchange with another nonce = %v, want a nonce mismatch", err)
+	}
+}
+
+func TestVerifyIDTokenClaims(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+
+	tests := []struct {
+		name   string
+		change func(jwt.MapClaims)
+		valid  bool
+	}{
+		{"valid", func(jwt.MapClaims) {}, true},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, false},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "other-client" }, false},
+		{"several audiences without azp", func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "other-client"} }, false},
+		{"several audiences with azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "other-client"}
+			c["azp"] = testClientID
+		}, true},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, false},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }, false},
+		{"no nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, false},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := issuer.claims("nonce-1")
+			test.change(claims)
+
+			_, err := provider.VerifyIDToken(context.Background(), issuer.sign(t, claims), "nonce-1")
+			if test.valid && err != nil {
+				t.Fatalf("VerifyIDToken = %v, want success", err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("VerifyIDToken = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsForeignKey(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+
+	// Signed with a key that has the published kid but is not the published key
+	forged, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, issuer.claims("nonce-1"))
+	token.Header["kid"] = issuer.kid
+	raw, err := token.SignedString(forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.VerifyIDToken(context.Background(), raw, "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("VerifyIDToken = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestKeyRotationRefetchesJWKS(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	if _, err := provider.VerifyIDToken(ctx, issuer.sign(t, issuer.claims("nonce-1")), "nonce-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	issuer.rotate(t, "key-2")
+	rotated := issuer.sign(t, issuer.claims("nonce-1"))
+
+	// Unknown kids refetch the key set at most once a minute
+	if _, err := provider.VerifyIDToken(ctx, rotated, "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("VerifyIDToken right after the first fetch = %v, want ErrInvalidIDToken", err)
+	}
+	if n := issuer.fetches(); n != 1 {
+		t.Fatalf("key set fetched %d times, want 1", n)
+	}
+
+	provider.keys.fetchedAt = time.Now().Add(-2 * time.Minute)
+	if _, err := provider.VerifyIDToken(ctx, rotated, "nonce-1"); err != nil {
+		t.Fatalf("VerifyIDToken with the rotated key = %v", err)
+	}
+	if n := issuer.fetches(); n != 2 {
+		t.Fatalf("key set fetched %d times, want 2", n)
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	provider.Issuer = issuer.URL + "/"
+
+	if _, err := provider.NewAuthRequest(context.Background()); err == nil {
+		t.Fatal("discovery with a different issuer should fail")
+	}
+}
@@ -0,0 +1,172 @@
+// Package oidc implements the client side of the OpenID Connect
+// authorization code flow with PKCE. It only speaks the protocol; storing
+// pending logins and linking identities to users is left to the caller.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownProvider is returned by Lookup for providers that are not configured
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// Providers holds the configured providers by name, loaded by Init
+var Providers = map[string]*Provider{}
+
+// Provider is an OpenID Connect identity provider, such as Google. Endpoints
+// are discovered from the issuer's /.well-known/openid-configuration.
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// HTTPClient is used for discovery, token and key requests.
+	// http.DefaultClient with a timeout is used when it is nil.
+	HTTPClient *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      *keySet
+}
+
+// discovery is the part of the provider metadata the flow needs
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// Init loads the providers listed in OIDC_PROVIDERS (comma-separated names,
+// e.g. "google"). Each provider is configured with
+//
+//	OIDC_<NAME>_ISSUER         issuer URL, https://accounts.google.com for Google
+//	OIDC_<NAME>_CLIENT_ID      client ID registered with the provider
+//	OIDC_<NAME>_CLIENT_SECRET  client secret
+//	OIDC_<NAME>_REDIRECT_URL   page the provider sends the user back to
+//	OIDC_<NAME>_SCOPES         space-separated scopes, default "openid email profile"
+//
+// redirectURL builds the default redirect URL for a provider name.
+func Init(redirectURL func(name string) string) error {
+	providers := map[string]*Provider{}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := &Provider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			return fmt.Errorf("provider %s: %sISSUER and %sCLIENT_ID are required", name, prefix, prefix)
+		}
+		if provider.RedirectURL == "" {
+			provider.RedirectURL = redirectURL(name)
+		}
+
+		providers[name] = provider
+	}
+
+	Providers = providers
+	return nil
+}
+
+// Lookup returns the configured provider with the name
+func Lookup(name string) (*Provider, error) {
+	provider, ok := Providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// Names returns the names of the configured providers in alphabetical order
+func Names() []string {
+	names := make([]string, 0, len(Providers))
+	for name := range Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *Provider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return defaultClient
+}
+
+func (p *Provider) scopes() []string {
+	if len(p.Scopes) == 0 {
+		return []string{"openid", "email", "profile"}
+	}
+	return p.Scopes
+}
+
+// metadata fetches the provider metadata once and caches it
+func (p *Provider) metadata(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var meta discovery
+	url := strings.TrimRight(p.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, url, &meta); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+
+	if meta.Issuer != p.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", meta.Issuer, p.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("discovery: provider metadata is incomplete")
+	}
+
+	p.discovery = &meta
+	return p.discovery, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,150 @@
+// Package passwords hashes and verifies user passwords and enforces the
+// password policy. Hash formats are kept in a registry so that hashes made
+// with an older algorithm or cost keep working and can be upgraded when the
+// user next logs in.
+package passwords
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+)
+
+// ErrUnknownFormat is returned when no registered hasher recognises a stored hash
+var ErrUnknownFormat = errors.New("unknown password hash format")
+
+// Hasher is a password hashing algorithm with its current parameters
+type Hasher interface {
+	// Name identifies the hasher in PASSWORD_HASHER
+	Name() string
+	// Hash returns a self-describing hash of the password
+	Hash(password string) ([]byte, error)
+	// Identifies reports whether the hash was made by this algorithm
+	Identifies(hash []byte) bool
+	// Verify reports whether the password matches a hash made by this algorithm
+	Verify(hash []byte, password string) (bool, error)
+	// NeedsRehash reports whether the hash was made with other parameters than the current ones
+	NeedsRehash(hash []byte) bool
+	// MaxLength is the longest password in bytes the algorithm uses in full, or 0 if there is no limit
+	MaxLength() int
+}
+
+var (
+	registry = map[string]Hasher{}
+	// current hashes new passwords
+	current Hasher
+	// slots limits how many hashes are computed at once. argon2id allocates
+	// its whole memory cost per hash, and logins, including those for
+	// unknown emails, can be sent in parallel by anyone.
+	slots = make(chan struct{}, runtime.GOMAXPROCS(0))
+)
+
+func init() {
+	Register(&Bcrypt{Cost: 14})
+	Register(&Argon2id{Time: 3, Memory: 64 * 1024, Threads: 4})
+	current = registry["argon2id"]
+}
+
+// Register adds a hasher to the registry, replacing one with the same name
+func Register(h Hasher) {
+	registry[h.Name()] = h
+}
+
+// Use makes the named registered hasher the one that hashes new passwords
+func Use(name string) error {
+	h, ok := registry[name]
+	if !ok {
+		return fmt.Errorf("unknown password hasher %q", name)
+	}
+	current = h
+	return nil
+}
+
+// Hash hashes the password with the current hasher
+func Hash(password string) ([]byte, error) {
+	defer acquire()()
+	return current.Hash(password)
+}
+
+// acquire waits for a free hashing slot and returns the function releasing it
+func acquire() func() {
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// MaxLength is the longest password in bytes the current hasher uses in
+// full, or 0 if there is no limit
+func MaxLength() int {
+	return current.MaxLength()
+}
+
+// Verify checks the password against a stored hash of any registered format.
+// rehash is true when the password matched but the hash should be replaced
+// with Hash(password), because it uses another algorithm or outdated parameters.
+func Verify(hash []byte, password string) (ok bool, rehash bool, err error) {
+	for _, h := range registry {
+		if !h.Identifies(hash) {
+			continue
+		}
+
+		release := acquire()
+		ok, err = h.Verify(hash, password)
+		release()
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, h != current || h.NeedsRehash(hash), nil
+	}
+
+	return false, false, ErrUnknownFormat
+}
+
+// Init configures hashing and the password policy from the environment:
+//
+//	PASSWORD_HASHER      argon2id (default) or bcrypt, used for new hashes
+//	BCRYPT_COST          bcrypt cost (default 14)
+//	ARGON2_TIME          argon2id iterations (default 3)
+//	ARGON2_MEMORY        argon2id memory in KiB (default 65536)
+//	ARGON2_THREADS       argon2id parallelism (default 4)
+//	PASSWORD_HASH_LIMIT  hashes computed at once (default GOMAXPROCS); with
+//	                     argon2id, at most this times ARGON2_MEMORY is in use
+//	PASSWORD_MIN_LENGTH  minimum password length (default 8)
+//	PASSWORD_BLOCKLIST   file with common or breached passwords, one per line
+func Init() {
+	Register(&Bcrypt{Cost: intFromEnv("BCRYPT_COST", 14)})
+	Register(&Argon2id{
+		Time:    uint32(intFromEnv("ARGON2_TIME", 3)),
+		Memory:  uint32(intFromEnv("ARGON2_MEMORY", 64*1024)),
+		Threads: uint8(intFromEnv("ARGON2_THREADS", 4)),
+	})
+
+	slots = make(chan struct{}, intFromEnv("PASSWORD_HASH_LIMIT", runtime.GOMAXPROCS(0)))
+
+	name := os.Getenv("PASSWORD_HASHER")
+	if name == "" {
+		name = "argon2id"
+	}
+	if err := Use(name); err != nil {
+		log.Fatal(err)
+	}
+
+	policy := Policy{MinLength: intFromEnv("PASSWORD_MIN_LENGTH", 8)}
+	if path := os.Getenv("PASSWORD_BLOCKLIST"); path != "" {
+		blocklist, err := LoadBlocklist(path)
+		if err != nil {
+			log.Fatalf("cannot load PASSWORD_BLOCKLIST: %v", err)
+		}
+		policy.Blocklist = blocklist
+	}
+	DefaultPolicy = policy
+}
+
+func intFromEnv(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
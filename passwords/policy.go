@@ -0,0 +1,65 @@
+package passwords
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrBlocklisted is returned for passwords on the blocklist
+var ErrBlocklisted = errors.New("password is too common or has appeared in a data breach")
+
+// Policy is what a new password has to satisfy
+type Policy struct {
+	MinLength int
+	// Blocklist holds rejected passwords in lower case
+	Blocklist map[string]struct{}
+}
+
+// DefaultPolicy is the policy applied by Check, set by Init
+var DefaultPolicy = Policy{MinLength: 8}
+
+// Check validates a new password against the default policy
+func Check(password string) error {
+	return DefaultPolicy.Check(password)
+}
+
+// Check returns an error describing why the password is rejected, or nil
+func (p Policy) Check(password string) error {
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	// Passwords longer than the hasher uses would silently lose strength
+	if max := MaxLength(); max > 0 && len(password) > max {
+		return fmt.Errorf("password must be at most %d bytes long", max)
+	}
+	if _, ok := p.Blocklist[strings.ToLower(password)]; ok {
+		return ErrBlocklisted
+	}
+	return nil
+}
+
+// LoadBlocklist reads a file with one password per line. Empty lines and
+// lines starting with # are skipped.
+func LoadBlocklist(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	blocklist := map[string]struct{}{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocklist[strings.ToLower(line)] = struct{}{}
+	}
+
+	return blocklist, scanner.Err()
+}
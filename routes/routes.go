@@ -1,11 +1,10 @@
 package routes
 
 import (
-	"os"
-
 	"github.com/gofiber/fiber/v2"
-	jwtware "github.com/gofiber/jwt/v3"
+	"github.com/raihan1405/go-restapi/auth"
 	"github.com/raihan1405/go-restapi/controllers"
+	"github.com/raihan1405/go-restapi/middleware"
 )
 
 func Setup(app *fiber.App) {
@@ -13,21 +12,95 @@ func Setup(app *fiber.App) {
 	// Rute publik yang tidak membutuhkan autentikasi
 	app.Post("/api/register", controllers.Register)
 	app.Post("/api/login", controllers.Login)
-	app.Post("/api/products", controllers.AddProduct)
+	app.Post("/api/login/mfa", controllers.LoginMFA)
+	app.Post("/api/login/magic-link", controllers.RequestMagicLink)
+	app.Get("/api/login/magic-link/callback", controllers.MagicLinkCallback)
+	app.Get("/api/login/oidc", controllers.GetOIDCProviders)
+	app.Post("/api/login/oidc/:provider", controllers.StartOIDCLogin)
+	app.Post("/api/login/oidc/:provider/callback", controllers.OIDCCallback)
+	app.Post("/api/token/refresh", controllers.RefreshToken)
+	app.Post("/api/password/forgot", controllers.ForgotPassword)
+	app.Post("/api/password/reset", controllers.ResetPassword)
+	app.Get("/api/verify-email", controllers.VerifyEmail)
+	app.Post("/api/verify-email/resend", controllers.ResendVerificationEmail)
 	app.Get("/api/products", controllers.GetAllProducts)
-	app.Put("/api/products/:id", controllers.EditProduct)
+	app.Get("/api/products/search", controllers.SearchProducts)
+	app.Get("/api/products/search/suggest", controllers.SuggestProducts)
+	app.Get("/api/products/:id", controllers.GetProduct)
+	app.Get("/api/categories", controllers.GetCategoryTree)
+	app.Get("/api/categories/:id", controllers.GetCategory)
+	app.Get("/api/brands", controllers.GetBrands)
+	app.Get("/api/brands/:id", controllers.GetBrand)
+	app.Get("/.well-known/jwks.json", controllers.GetJWKS)
 
 	// Middleware JWT untuk melindungi rute di bawah ini
-	api := app.Group("/api", jwtware.New(jwtware.Config{
-		SigningKey: []byte(os.Getenv("JWT_SECRET")), // Gantilah dengan kunci rahasia yang sebenarnya
-		TokenLookup: "cookie:jwt",
-	}))
-
-	// Rute yang dilindungi oleh JWT middleware
-	api.Get("/user", controllers.GetUser)
-	api.Post("/logout", controllers.Logout)
-	api.Put("/user", controllers.UpdateProfile)
-	api.Put("/user/password", controllers.UpdatePassword)
+	api := app.Group("/api", middleware.Authenticate())
+
+	// Rute yang dilindungi oleh JWT middleware. Setiap rute yang bisa dipakai
+	// dengan API key memerlukan permission, sehingga key dengan scope hanya
+	// bisa memakai rute yang termasuk scope-nya.
+	api.Get("/user", middleware.RequirePermission(auth.PermProfileRead), controllers.GetUser)
+	// Logout mencabut sesi yang sedang dipakai, jadi tidak ada artinya dengan API key
+	api.Post("/logout", middleware.RequireSession(), controllers.Logout)
+
+	// Pengelolaan kredensial hanya lewat sesi login, tidak dengan API key,
+	// dan tidak oleh admin yang sedang menyamar sebagai pengguna. Profil
+	// termasuk di sini karena email dipakai untuk reset password.
+	account := api.Group("/user", middleware.RequireSession(), middleware.ForbidImpersonation())
+	account.Put("/", controllers.UpdateProfile)
+	account.Put("/password", controllers.UpdatePassword)
+	account.Get("/sessions", controllers.GetSessions)
+	account.Post("/sessions/revoke-others", controllers.RevokeOtherSessions)
+	account.Delete("/sessions/:id", controllers.RevokeSession)
+	account.Post("/mfa/enroll", controllers.EnrollMFA)
+	account.Post("/mfa/confirm", controllers.ConfirmMFA)
+	account.Post("/mfa/disable", controllers.DisableMFA)
+	account.Post("/mfa/recovery-codes", controllers.RegenerateRecoveryCodes)
+	account.Get("/api-keys", controllers.GetAPIKeys)
+	account.Post("/api-keys", controllers.CreateAPIKey)
+	account.Delete("/api-keys/:id", controllers.RevokeAPIKey)
+	account.Get("/export", controllers.ExportAccount)
+	account.Delete("/", controllers.DeleteAccount)
+
+	cart := api.Group("/cart", middleware.RequirePermission(auth.PermCartManage))
+	cart.Get("/", controllers.GetCart)
+	cart.Post("/", middleware.RequireVerifiedEmail(auth.VerifyBeforeCheckout), controllers.AddToCart)
+	cart.Put("/:id", middleware.RequireVerifiedEmail(auth.VerifyBeforeCheckout), controllers.UpdateCartItem)
+	cart.Delete("/:id", controllers.RemoveFromCart)
+
+	// Katalog hanya bisa diubah oleh seller (produk miliknya) dan admin
+	catalogue := api.Group("/products", middleware.RequirePermission(auth.PermProductWrite))
+	catalogue.Post("/", controllers.AddProduct)
+	catalogue.Put("/:id", controllers.EditProduct)
+	catalogue.Delete("/:id", controllers.DeleteProduct)
+
+	// Seller mengelola halaman brand miliknya sendiri, admin semua brand
+	brands := api.Group("/brands", middleware.RequirePermission(auth.PermProductWrite))
+	brands.Post("/", controllers.CreateBrand)
+	brands.Put("/:id", controllers.UpdateBrand)
+	brands.Delete("/:id", controllers.DeleteBrand)
+
+	// Rute khusus admin
+	admin := api.Group("/admin")
+	admin.Post("/users/:id/roles", middleware.RequirePermission(auth.PermRoleManage), controllers.GrantRole)
+	admin.Delete("/users/:id/roles/:role", middleware.RequirePermission(auth.PermRoleManage), controllers.RevokeRole)
+	admin.Get("/users", middleware.RequirePermission(auth.PermUserManage), controllers.ListUsers)
+	admin.Get("/users/:id", middleware.RequirePermission(auth.PermUserManage), controllers.GetUserDetails)
+	admin.Post("/users/:id/disable", middleware.RequirePermission(auth.PermUserManage), controllers.DisableUser)
+	admin.Post("/users/:id/enable", middleware.RequirePermission(auth.PermUserManage), controllers.EnableUser)
+	admin.Post("/users/:id/logout", middleware.RequirePermission(auth.PermUserManage), controllers.ForceLogoutUser)
+	admin.Post("/users/:id/mfa/reset", middleware.RequirePermission(auth.PermUserManage), controllers.ResetUserMFA)
+	admin.Put("/users/:id/role", middleware.RequirePermission(auth.PermRoleManage), controllers.ChangeUserRole)
+	admin.Post("/users/:id/unlock", middleware.RequirePermission(auth.PermUserManage), controllers.UnlockUser)
+	admin.Post("/users/:id/impersonate", middleware.RequireSession(), middleware.ForbidImpersonation(), middleware.RequirePermission(auth.PermUserImpersonate), controllers.ImpersonateUser)
+	admin.Get("/keys", middleware.RequirePermission(auth.PermKeyManage), controllers.GetSigningKeys)
+	admin.Post("/keys/rotate", middleware.RequirePermission(auth.PermKeyManage), controllers.RotateSigningKey)
+	admin.Post("/products/:id/restore", middleware.RequirePermission(auth.PermProductWriteAny), controllers.RestoreProduct)
+	admin.Delete("/products/:id", middleware.RequirePermission(auth.PermProductWriteAny), controllers.PurgeProduct)
+	admin.Post("/categories", middleware.RequirePermission(auth.PermCategoryManage), controllers.CreateCategory)
+	admin.Put("/categories/:id", middleware.RequirePermission(auth.PermCategoryManage), controllers.UpdateCategory)
+	admin.Delete("/categories/:id", middleware.RequirePermission(auth.PermCategoryManage), controllers.DeleteCategory)
+	admin.Get("/audit-events", middleware.RequirePermission(auth.PermAuditRead), controllers.ListAuditEvents)
 
 
 	
@@ -0,0 +1,48 @@
+// Package search is the product search. Index is the interface the handlers
+// use; MemoryIndex is an in-process inverted index implementing it.
+package search
+
+// Document is one searchable object. Fields hold the text that is searched,
+// Facets the values that results are counted by.
+type Document struct {
+	ID     int
+	Fields map[string]string
+	Facets map[string]string
+}
+
+// Query is a search request. Filters restrict the results to documents with
+// one of the given values for each facet. Limit 0 means no limit.
+type Query struct {
+	Text    string
+	Filters map[string][]string
+	Offset  int
+	Limit   int
+}
+
+// Hit is one matching document. Highlights holds the matched fields with the
+// matching words wrapped in <mark> tags; the rest of the text is HTML-escaped.
+type Hit struct {
+	ID         int
+	Score      float64
+	Highlights map[string]string
+}
+
+// Result is one page of hits, best first. Total and Facets cover every
+// matching document, not only the page.
+type Result struct {
+	Total  int
+	Hits   []Hit
+	Facets map[string]map[string]int
+}
+
+// Index keeps documents searchable
+type Index interface {
+	// Put adds the document or replaces the one with the same ID
+	Put(doc Document) error
+	// Remove drops the document with the ID, if there is one
+	Remove(id int) error
+	// Search returns the documents matching the query
+	Search(query Query) (*Result, error)
+	// Suggest completes a prefix to words that appear in the index, most frequent first
+	Suggest(prefix string, limit int) ([]string, error)
+}
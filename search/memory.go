@@ -0,0 +1,337 @@
+package search
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Relevance factors for query words that only match approximately
+const (
+	prefixFactor = 0.8 // the last query word is the start of an indexed word
+	fuzzyFactor  = 0.6 // per edit, for indexed words within maxEdits typos
+)
+
+// maxQueryWords is how many words of a query are searched for. Every word
+// is compared with the indexed terms of similar length, so this bounds the
+// time a query holds the index.
+const maxQueryWords = 10
+
+// MemoryIndex is an inverted index held in memory. A document only matches
+// when every query word matches one of its words, exactly, after stemming,
+// with a few typos, or, for the last query word, as a prefix, so results
+// can be shown while the user is still typing.
+type MemoryIndex struct {
+	mu      sync.RWMutex
+	weights map[string]float64
+	docs    map[int]Document
+	// postings maps each term to the documents containing it and how often
+	// it occurs in each of their fields
+	postings map[string]map[int]map[string]int
+	// lengths holds the terms by their length in runes, so that typos are
+	// only looked for among terms of about the length of the query word
+	lengths map[int]map[string]bool
+	// words counts the documents each unstemmed word appears in, for
+	// suggestions and prefix matches
+	words map[string]int
+}
+
+// NewMemoryIndex returns an empty index. Weights say how much a match in each
+// field counts; fields without a weight count 1.
+func NewMemoryIndex(weights map[string]float64) *MemoryIndex {
+	return &MemoryIndex{
+		weights:  weights,
+		docs:     map[int]Document{},
+		postings: map[string]map[int]map[string]int{},
+		lengths:  map[int]map[string]bool{},
+		words:    map[string]int{},
+	}
+}
+
+// Put adds the document or replaces the one with the same ID
+func (ix *MemoryIndex) Put(doc Document) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(doc.ID)
+	ix.docs[doc.ID] = doc
+
+	seen := map[string]bool{}
+	for field, text := range doc.Fields {
+		for _, tok := range tokenize(text) {
+			docs := ix.postings[tok.term]
+			if docs == nil {
+				docs = map[int]map[string]int{}
+				ix.postings[tok.term] = docs
+				ix.addLength(tok.term)
+			}
+			if docs[doc.ID] == nil {
+				docs[doc.ID] = map[string]int{}
+			}
+			docs[doc.ID][field]++
+
+			if !seen[tok.word] {
+				seen[tok.word] = true
+				ix.words[tok.word]++
+			}
+		}
+	}
+	return nil
+}
+
+// Remove drops the document with the ID, if there is one
+func (ix *MemoryIndex) Remove(id int) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+	return nil
+}
+
+func (ix *MemoryIndex) remove(id int) {
+	doc, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	delete(ix.docs, id)
+
+	seen := map[string]bool{}
+	for _, text := range doc.Fields {
+		for _, tok := range tokenize(text) {
+			if docs := ix.postings[tok.term]; docs != nil {
+				delete(docs, id)
+				if len(docs) == 0 {
+					delete(ix.postings, tok.term)
+					ix.removeLength(tok.term)
+				}
+			}
+
+			if !seen[tok.word] {
+				seen[tok.word] = true
+				if ix.words[tok.word]--; ix.words[tok.word] <= 0 {
+					delete(ix.words, tok.word)
+				}
+			}
+		}
+	}
+}
+
+func (ix *MemoryIndex) addLength(term string) {
+	n := len([]rune(term))
+	if ix.lengths[n] == nil {
+		ix.lengths[n] = map[string]bool{}
+	}
+	ix.lengths[n][term] = true
+}
+
+func (ix *MemoryIndex) removeLength(term string) {
+	n := len([]rune(term))
+	delete(ix.lengths[n], term)
+	if len(ix.lengths[n]) == 0 {
+		delete(ix.lengths, n)
+	}
+}
+
+// match is how a document matched a query
+type match struct {
+	score float64
+	words int             // query words matched
+	terms map[string]bool // indexed terms that matched, for highlighting
+	last  int             // index of the last query word counted in words
+}
+
+// Search returns the documents matching the query, best first. Words past
+// the first maxQueryWords of the query are ignored.
+func (ix *MemoryIndex) Search(query Query) (*Result, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	result := &Result{Hits: []Hit{}, Facets: map[string]map[string]int{}}
+	tokens := tokenize(query.Text)
+	if len(tokens) == 0 {
+		return result, nil
+	}
+	if len(tokens) > maxQueryWords {
+		tokens = tokens[:maxQueryWords]
+	}
+
+	total := float64(len(ix.docs))
+	matches := map[int]*match{}
+	for i, tok := range tokens {
+		for term, factor := range ix.expand(tok, i == len(tokens)-1) {
+			docs := ix.postings[term]
+			idf := math.Log(1 + total/float64(len(docs)))
+
+			for id, fields := range docs {
+				m := matches[id]
+				if m == nil {
+					m = &match{terms: map[string]bool{}, last: -1}
+					matches[id] = m
+				}
+				if m.last != i {
+					m.last = i
+					m.words++
+				}
+				m.terms[term] = true
+
+				for field, tf := range fields {
+					weight, ok := ix.weights[field]
+					if !ok {
+						weight = 1
+					}
+					m.score += weight * idf * factor * float64(tf) / float64(tf+1)
+				}
+			}
+		}
+	}
+
+	var hits []Hit
+	for id, m := range matches {
+		doc := ix.docs[id]
+		if m.words < len(tokens) || !matchesFilters(doc, query.Filters) {
+			continue
+		}
+
+		for facet, value := range doc.Facets {
+			if result.Facets[facet] == nil {
+				result.Facets[facet] = map[string]int{}
+			}
+			result.Facets[facet][value]++
+		}
+		hits = append(hits, Hit{ID: id, Score: m.score})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+
+	result.Total = len(hits)
+	if query.Offset >= len(hits) {
+		return result, nil
+	}
+	hits = hits[query.Offset:]
+	if query.Limit > 0 && len(hits) > query.Limit {
+		hits = hits[:query.Limit]
+	}
+
+	for i := range hits {
+		hits[i].Highlights = highlight(ix.docs[hits[i].ID], matches[hits[i].ID].terms)
+	}
+	result.Hits = hits
+	return result, nil
+}
+
+// expand finds the indexed terms a query word matches and how well. The
+// exact term counts fully, terms within a few typos and, for the last word,
+// terms it is a prefix of count less.
+func (ix *MemoryIndex) expand(tok token, last bool) map[string]float64 {
+	terms := map[string]float64{}
+	if _, ok := ix.postings[tok.term]; ok {
+		terms[tok.term] = 1
+	}
+
+	// The query word is compared with the unstemmed words, since a word
+	// being typed is often not a prefix of its stem ("runni" of "run")
+	if last && len(tok.word) >= 2 {
+		for word := range ix.words {
+			if term := stem(word); term != tok.term && strings.HasPrefix(word, tok.word) {
+				terms[term] = prefixFactor
+			}
+		}
+	}
+
+	edits := maxEdits(tok.term)
+	if edits == 0 {
+		return terms
+	}
+	n := len([]rune(tok.term))
+	for length := n - edits; length <= n+edits; length++ {
+		for term := range ix.lengths[length] {
+			if term == tok.term {
+				continue
+			}
+			if d := editDistance(tok.term, term, edits); d <= edits && math.Pow(fuzzyFactor, float64(d)) > terms[term] {
+				terms[term] = math.Pow(fuzzyFactor, float64(d))
+			}
+		}
+	}
+	return terms
+}
+
+// matchesFilters reports whether the document has one of the filtered values
+// for every filtered facet
+func matchesFilters(doc Document, filters map[string][]string) bool {
+	for facet, values := range filters {
+		matched := false
+		for _, value := range values {
+			if strings.EqualFold(doc.Facets[facet], value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// highlight marks the words of the document whose terms matched. Fields
+// without a match are left out.
+func highlight(doc Document, terms map[string]bool) map[string]string {
+	highlights := map[string]string{}
+	for field, text := range doc.Fields {
+		var b strings.Builder
+		pos, marked := 0, false
+		for _, tok := range tokenize(text) {
+			if !terms[tok.term] {
+				continue
+			}
+			b.WriteString(html.EscapeString(text[pos:tok.start]))
+			b.WriteString("<mark>")
+			b.WriteString(html.EscapeString(text[tok.start:tok.end]))
+			b.WriteString("</mark>")
+			pos, marked = tok.end, true
+		}
+		if marked {
+			b.WriteString(html.EscapeString(text[pos:]))
+			highlights[field] = b.String()
+		}
+	}
+	return highlights
+}
+
+// Suggest completes a prefix to words that appear in the index, most frequent first
+func (ix *MemoryIndex) Suggest(prefix string, limit int) ([]string, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	suggestions := []string{}
+	if prefix == "" {
+		return suggestions, nil
+	}
+
+	for word := range ix.words {
+		if strings.HasPrefix(word, prefix) {
+			suggestions = append(suggestions, word)
+		}
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if ix.words[a] != ix.words[b] {
+			return ix.words[a] > ix.words[b]
+		}
+		return a < b
+	})
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,60 @@
+package search
+
+import "testing"
+
+// newTestIndex returns an index holding the given product names, with IDs
+// counting from 1
+func newTestIndex(t *testing.T, names ...string) *MemoryIndex {
+	t.Helper()
+
+	ix := NewMemoryIndex(nil)
+	for i, name := range names {
+		if err := ix.Put(Document{ID: i + 1, Fields: map[string]string{"productName": name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ix
+}
+
+func TestSearchAsYouType(t *testing.T) {
+	ix := newTestIndex(t, "Running Shoes", "Rain Jacket")
+
+	// Every prefix of "running" has to keep finding the shoes, also the
+	// ones that are no prefix of the stem "run"
+	for _, text := range []string{"ru", "run", "runn", "runni", "runnin", "running", "shoes ru", "shoes runni"} {
+		result, err := ix.Search(Query{Text: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Total != 1 || result.Hits[0].ID != 1 {
+			t.Errorf("Search(%q) = %+v, want only the running shoes", text, result.Hits)
+		}
+	}
+}
+
+func TestSearchPrefixOnlyForLastWord(t *testing.T) {
+	ix := newTestIndex(t, "Running Shoes")
+
+	result, err := ix.Search(Query{Text: "runni shoes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 0 {
+		t.Errorf("Search(%q) found %d products, want none", "runni shoes", result.Total)
+	}
+}
+
+func TestSearchFindsTypos(t *testing.T) {
+	ix := newTestIndex(t, "Running Shoes", "Rain Jacket")
+
+	// Typos that add, drop and change a letter
+	for _, text := range []string{"shoez", "jackt", "jackey", "raim"} {
+		result, err := ix.Search(Query{Text: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Total != 1 {
+			t.Errorf("Search(%q) found %d products, want 1", text, result.Total)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package search
+
+import (
+	"log"
+
+	"github.com/raihan1405/go-restapi/db"
+	"github.com/raihan1405/go-restapi/models"
+	"gorm.io/gorm"
+)
+
+// Facets products are counted by
+const (
+	FacetCategory = "category"
+	FacetBrand    = "brand"
+)
+
+// Products is the index of the catalogue. Deleted products are not in it.
+var Products Index = NewMemoryIndex(map[string]float64{
+	"productName": 3,
+	"brandName":   2,
+	"category":    1,
+})
+
+// ProductDocument maps a product to its search document. Field names are the
+// JSON names of the product, so highlights line up with the product body.
+func ProductDocument(product models.Product) Document {
+	return Document{
+		ID: product.ID,
+		Fields: map[string]string{
+			"productName": product.ProductName,
+			"brandName":   product.BrandName,
+			"category":    product.Category,
+		},
+		Facets: map[string]string{
+			FacetCategory: product.Category,
+			FacetBrand:    product.BrandName,
+		},
+	}
+}
+
+// IndexProduct brings the index up to date with a product that was saved,
+// deleted or restored. Failures are logged; the product itself is saved.
+func IndexProduct(product models.Product) {
+	var err error
+	if product.DeletedAt.Valid {
+		err = Products.Remove(product.ID)
+	} else {
+		err = Products.Put(ProductDocument(product))
+	}
+	if err != nil {
+		log.Printf("cannot index product %d: %v", product.ID, err)
+	}
+}
+
+// RemoveProduct drops a product from the index
+func RemoveProduct(id int) {
+	if err := Products.Remove(id); err != nil {
+		log.Printf("cannot remove product %d from the index: %v", id, err)
+	}
+}
+
+// Init indexes the whole catalogue. It is called once at startup; after that
+// the product handlers keep the index current.
+func Init() {
+	var products []models.Product
+	err := db.DB.FindInBatches(&products, 500, func(tx *gorm.DB, batch int) error {
+		for _, product := range products {
+			if err := Products.Put(ProductDocument(product)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		log.Printf("cannot build the product search index: %v", err)
+	}
+}
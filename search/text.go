@@ -0,0 +1,137 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// token is a word of a text together with where it is
+type token struct {
+	word       string // lowercased
+	term       string // stemmed, what the index stores
+	start, end int    // byte offsets in the original text
+}
+
+// tokenize splits text into words of letters and digits
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		wordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if wordRune && start < 0 {
+			start = i
+		} else if !wordRune && start >= 0 {
+			tokens = append(tokens, newToken(text, start, i))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, newToken(text, start, len(text)))
+	}
+	return tokens
+}
+
+func newToken(text string, start, end int) token {
+	word := strings.ToLower(text[start:end])
+	return token{word: word, term: stem(word), start: start, end: end}
+}
+
+// stem reduces an English word to a rough stem by stripping common
+// inflections, so that "shoes" finds "shoe" and "running" finds "run".
+// It is deliberately light: words it does not know are left alone.
+func stem(word string) string {
+	n := len(word)
+	switch {
+	case n <= 3:
+		return word
+	case strings.HasSuffix(word, "ies") && n > 4:
+		return word[:n-3] + "y"
+	case strings.HasSuffix(word, "sses"):
+		return word[:n-2]
+	case strings.HasSuffix(word, "ing") && n > 5:
+		return undouble(word[:n-3])
+	case strings.HasSuffix(word, "ed") && n > 4:
+		return undouble(word[:n-2])
+	case strings.HasSuffix(word, "ly") && n > 4:
+		return word[:n-2]
+	case strings.HasSuffix(word, "es") && hasSibilantBefore(word[:n-2]):
+		return word[:n-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us"):
+		return word[:n-1]
+	}
+	return word
+}
+
+// undouble turns "runn" back into "run"
+func undouble(word string) string {
+	n := len(word)
+	if n >= 2 && word[n-1] == word[n-2] && !strings.ContainsRune("lsz", rune(word[n-1])) {
+		return word[:n-1]
+	}
+	return word
+}
+
+// hasSibilantBefore reports whether "es" after the word is a plural ending, as in boxes or watches
+func hasSibilantBefore(word string) bool {
+	for _, suffix := range []string{"s", "x", "z", "ch", "sh"} {
+		if strings.HasSuffix(word, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxEdits is how many typos a query word of the given length may contain
+func maxEdits(word string) int {
+	switch n := len([]rune(word)); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	}
+	return 0
+}
+
+// editDistance is the Levenshtein distance between a and b, giving up with
+// max+1 once the distance is known to exceed max
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > max || -d > max {
+		return max + 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,123 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("Nike Air-Max 90, running shoes!")
+
+	var words, terms []string
+	for _, tok := range tokens {
+		words = append(words, tok.word)
+		terms = append(terms, tok.term)
+	}
+	if want := []string{"nike", "air", "max", "90", "running", "shoes"}; !reflect.DeepEqual(words, want) {
+		t.Errorf("words = %v, want %v", words, want)
+	}
+	if want := []string{"nike", "air", "max", "90", "run", "shoe"}; !reflect.DeepEqual(terms, want) {
+		t.Errorf("terms = %v, want %v", terms, want)
+	}
+	if tok := tokens[4]; tok.start != 17 || tok.end != 24 {
+		t.Errorf("running at %d-%d, want 17-24", tok.start, tok.end)
+	}
+}
+
+func TestStem(t *testing.T) {
+	tests := map[string]string{
+		// plurals
+		"shoes":     "shoe",
+		"bags":      "bag",
+		"batteries": "battery",
+		"dresses":   "dress",
+		"boxes":     "box",
+		"watches":   "watch",
+		"brushes":   "brush",
+		// -ing and -ed, with doubled consonants undone
+		"running": "run",
+		"walking": "walk",
+		"stopped": "stop",
+		"printed": "print",
+		"rolling": "roll",
+		// -ly
+		"quickly": "quick",
+		// words that only look inflected
+		"glass":  "glass",
+		"cactus": "cactus",
+		"bus":    "bus",
+		"king":   "king",
+		"bed":    "bed",
+		"red":    "red",
+		"sing":   "sing",
+		// unknown words are left alone
+		"nike": "nike",
+		"90":   "90",
+		"":     "",
+		// but a final s is stripped from any word, English or not
+		"kaos": "kao",
+	}
+
+	for word, want := range tests {
+		if got := stem(word); got != want {
+			t.Errorf("stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestStemMatchesInflections(t *testing.T) {
+	for _, group := range [][]string{
+		{"shoe", "shoes"},
+		{"run", "running", "runs"},
+		{"jacket", "jackets"},
+		{"battery", "batteries"},
+	} {
+		for _, word := range group[1:] {
+			if stem(word) != stem(group[0]) {
+				t.Errorf("stem(%q) = %q, want the stem of %q, %q", word, stem(word), group[0], stem(group[0]))
+			}
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		max  int
+		want int
+	}{
+		{"shoe", "shoe", 2, 0},
+		{"shoe", "shoes", 2, 1},
+		{"shoe", "sho", 2, 1},
+		{"shoe", "shoa", 2, 1},
+		{"jacket", "jakcet", 2, 2},
+		{"kitten", "sitting", 3, 3},
+		{"", "abc", 3, 3},
+		{"abc", "", 3, 3},
+		// non-ASCII letters count as one edit
+		{"café", "cafe", 1, 1},
+		{"müller", "muller", 1, 1},
+		// beyond max it gives up with max+1
+		{"kitten", "sitting", 2, 3},
+		{"a", "abcdef", 2, 3},
+		{"abcdef", "uvwxyz", 1, 2},
+	}
+
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b, test.max); got != test.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", test.a, test.b, test.max, got, test.want)
+		}
+		if got := editDistance(test.b, test.a, test.max); got != test.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", test.b, test.a, test.max, got, test.want)
+		}
+	}
+}
+
+func TestMaxEdits(t *testing.T) {
+	tests := map[string]int{"bag": 0, "shoe": 1, "jackets": 1, "sneakers": 2, "café": 1}
+	for word, want := range tests {
+		if got := maxEdits(word); got != want {
+			t.Errorf("maxEdits(%q) = %d, want %d", word, got, want)
+		}
+	}
+}
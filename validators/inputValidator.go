@@ -1,6 +1,10 @@
 package validators
 
-import "github.com/go-playground/validator/v10"
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
 
 var Validate = validator.New()
 
@@ -8,7 +12,7 @@ type RegisterInput struct {
 	Email       string `json:"email" validate:"required,email"`
 	PhoneNumber string `json:"phoneNumber" validate:"required"`
 	Username    string `json:"username" validate:"required"`
-	Password    string `json:"password" validate:"required,min=6"`
+	Password    string `json:"password" validate:"required"`
 }
 
 type LoginInput struct {
@@ -24,24 +28,32 @@ type UpdateUserInput struct {
 
 type UpdatePasswordInput struct {
     OldPassword string `json:"old_password" validate:"required"`
-    NewPassword string `json:"new_password" validate:"required,min=8"`
+    NewPassword string `json:"new_password" validate:"required"`
+    // RevokeOtherSessions logs out every other device, defaults to true
+    RevokeOtherSessions *bool `json:"revoke_other_sessions"`
 }
 
 type AddProductInput struct {
     ProductName string `json:"productName" validate:"required"`
-    BrandName   string `json:"brandName" validate:"required"`
+    // BrandID is preferred; BrandName is looked up by its slug
+    BrandID     int    `json:"brandId" validate:"required_without=BrandName"`
+    BrandName   string `json:"brandName" validate:"required_without=BrandID,max=100"`
     Price       int    `json:"price" validate:"required"`
     Quantity    int    `json:"quantity" validate:"required"`
-    Category    string  `json:"category" validate:"required"`
+    // CategoryID is preferred; Category is looked up by its slug
+    CategoryID  int    `json:"categoryId" validate:"required_without=Category"`
+    Category    string `json:"category" validate:"required_without=CategoryID"`
 }
 
 // EditProductInput represents the input data for editing an existing product
 type EditProductInput struct {
     ProductName string  `json:"productName" validate:"required,min=2,max=100"`
-    BrandName   string  `json:"brandName" validate:"required,min=2,max=100"`
+    BrandID     int     `json:"brandId" validate:"required_without=BrandName"`
+    BrandName   string  `json:"brandName" validate:"required_without=BrandID,max=100"`
     Price       float64 `json:"price" validate:"required,gt=0"`
     Quantity    int     `json:"quantity"` // Tanpa validasi min=0
-    Category    string  `json:"category" validate:"required"`
+    CategoryID  int     `json:"categoryId" validate:"required_without=Category"`
+    Category    string  `json:"category" validate:"required_without=CategoryID"`
 }
 
 type AddToCartInput struct {
@@ -52,3 +64,110 @@ type AddToCartInput struct {
 type UpdateCartItemInput struct {
 	Quantity int `json:"quantity" validate:"required,min=1"`
 }
+
+type RoleInput struct {
+	Role string `json:"role" validate:"required,oneof=admin seller customer"`
+}
+
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+type ResendVerificationInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type LoginMFAInput struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode   string `json:"recoveryCode" validate:"required_without=Code"`
+}
+
+type MFACodeInput struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type DisableMFAInput struct {
+	// Password is required unless the account has none
+	Password     string `json:"password"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recoveryCode" validate:"required_without=Code"`
+}
+
+type CreateAPIKeyInput struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type RotateKeyInput struct {
+	Algorithm string `json:"algorithm" validate:"omitempty,oneof=RS256 EdDSA"`
+}
+
+type OIDCCallbackInput struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+type MagicLinkInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type DeleteAccountInput struct {
+	// Password is required unless the account has none, such as accounts
+	// created through a social login
+	Password string `json:"password"`
+	// Code or RecoveryCode is required when two-factor authentication is enabled
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type ProductListQuery struct {
+	Category   string `query:"category" validate:"omitempty,max=100"`
+	CategoryID *int   `query:"category_id" validate:"omitempty,min=1"`
+	Brand      string `query:"brand" validate:"omitempty,max=100"`
+	BrandID    *int   `query:"brand_id" validate:"omitempty,min=1"`
+	MinPrice   *int   `query:"min_price" validate:"omitempty,min=0"`
+	MaxPrice   *int   `query:"max_price" validate:"omitempty,min=0"`
+	InStock    *bool  `query:"in_stock"`
+	Seller     *int   `query:"seller" validate:"omitempty,min=1"`
+	// Sort is a comma-separated list of fields, each optionally prefixed with - for descending order
+	Sort   string `query:"sort" validate:"omitempty,max=200"`
+	Page   int    `query:"page" validate:"omitempty,min=1"`
+	Limit  int    `query:"limit" validate:"omitempty,min=1,max=100"`
+	Cursor string `query:"cursor" validate:"omitempty,max=1024"`
+}
+
+type ProductSearchQuery struct {
+	Q        string `query:"q" validate:"required,max=200"`
+	Category string `query:"category" validate:"omitempty,max=100"`
+	Brand    string `query:"brand" validate:"omitempty,max=100"`
+	Page     int    `query:"page" validate:"omitempty,min=1"`
+	Limit    int    `query:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+type CategoryInput struct {
+	Name string `json:"name" validate:"required,max=100"`
+	// Slug defaults to the name, slugified
+	Slug     string `json:"slug" validate:"omitempty,max=100"`
+	ParentID *int   `json:"parentId" validate:"omitempty,min=1"`
+	Position int    `json:"position"`
+}
+
+type BrandInput struct {
+	Name string `json:"name" validate:"required,max=100"`
+	// Slug defaults to the name, slugified
+	Slug string `json:"slug" validate:"omitempty,max=100"`
+	// LogoURL is shown on the public brand page, so only https is accepted
+	LogoURL     string `json:"logoUrl" validate:"omitempty,http_url,startswith=https://,max=512"`
+	Description string `json:"description" validate:"max=2000"`
+}
@@ -0,0 +1,58 @@
+package validators
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidPhoneNumber is returned for phone numbers that cannot be put in E.164 form
+var ErrInvalidPhoneNumber = errors.New("phone number must be in international format, e.g. +6281234567890")
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// NormalizeEmail trims and case-folds an email address so that the same
+// mailbox is always stored and looked up the same way
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone returns the phone number in E.164 form. Spaces, dashes,
+// dots and parentheses are dropped, a 00 prefix becomes +, and national
+// numbers starting with 0 get the country code from
+// PHONE_DEFAULT_COUNTRY_CODE (default 62, Indonesia).
+func NormalizePhone(phone string) (string, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidPhoneNumber
+		}
+	}
+
+	number := b.String()
+	switch {
+	case strings.HasPrefix(number, "+"):
+	case strings.HasPrefix(number, "00"):
+		number = "+" + number[2:]
+	case strings.HasPrefix(number, "0"):
+		countryCode := os.Getenv("PHONE_DEFAULT_COUNTRY_CODE")
+		if countryCode == "" {
+			countryCode = "62"
+		}
+		number = "+" + strings.TrimPrefix(countryCode, "+") + number[1:]
+	default:
+		number = "+" + number
+	}
+
+	if !e164.MatchString(number) {
+		return "", ErrInvalidPhoneNumber
+	}
+	return number, nil
+}